@@ -2,17 +2,42 @@ package cloudfunc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/juliaogris/covid19/pkg/covid19"
+	"github.com/juliaogris/covid19/pkg/table"
 )
 
 const conn = "" // connection string parsed from envvars by lib/pq
 
+func scrapeWiki(ctx context.Context) (*table.Table, *table.Report, error) {
+	sink, err := table.OpenSinkContext(ctx, conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer sink.Close()
+	return covid19.ScrapeWikiContext(ctx, covid19.WikiURL, sink)
+}
+
 func Covid19HTTP(w http.ResponseWriter, r *http.Request) {
-	t, err := covid19.ScrapeWiki(covid19.WikiURL, conn)
+	t, report, err := scrapeWiki(r.Context())
+	if report != nil && len(report.Rejected) > 0 {
+		log.Println("Covid19HTTP:", report)
+		fmt.Fprintln(w, report)
+	}
+	if errors.Is(err, table.ErrUnchanged) {
+		log.Println("Covid19HTTP: no changes since last snapshot.")
+		fmt.Fprintln(w, "No changes since last snapshot.")
+		return
+	}
+	if errors.Is(err, table.ErrNotModified) {
+		log.Println("Covid19HTTP: page not modified since last scrape.")
+		fmt.Fprintln(w, "Page not modified since last scrape.")
+		return
+	}
 	if err != nil {
 		log.Println("Covid19HTTP ERROR:", err)
 		fmt.Fprintln(w, "Error", err)
@@ -23,7 +48,18 @@ func Covid19HTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func Covid19Event(ctx context.Context, _ interface{}) error {
-	t, err := covid19.ScrapeWiki(covid19.WikiURL, conn)
+	t, report, err := scrapeWiki(ctx)
+	if report != nil && len(report.Rejected) > 0 {
+		log.Println("ConvidEvent:", report)
+	}
+	if errors.Is(err, table.ErrUnchanged) {
+		log.Println("ConvidEvent: no changes since last snapshot.")
+		return nil
+	}
+	if errors.Is(err, table.ErrNotModified) {
+		log.Println("ConvidEvent: page not modified since last scrape.")
+		return nil
+	}
 	if err != nil {
 		log.Println("ConvidEvent ERROR:", err)
 		return err
@@ -4,6 +4,9 @@ go 1.13
 
 require (
 	github.com/lib/pq v1.3.0
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/stretchr/testify v1.5.1
 	golang.org/x/net v0.0.0-20200320220750-118fecf932d8
+	golang.org/x/text v0.3.3
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,279 @@
+package covid19
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juliaogris/covid19/pkg/table"
+)
+
+// WikiAPIURL is the MediaWiki API endpoint of English Wikipedia.
+const WikiAPIURL = "https://en.wikipedia.org/w/api.php"
+
+// WikiTitle is the title of the Wikipedia article at WikiURL.
+const WikiTitle = "2019–20 coronavirus pandemic by country and territory"
+
+// Revision is a revision of a Wikipedia article.
+type Revision struct {
+	ID        int64     `json:"revid"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// BackfillFunc is called by Backfill with the outcome of every scraped
+// revision; err is a scrape error or table.ErrUnchanged. Backfilling
+// stops if it returns an error.
+type BackfillFunc func(rev Revision, t *table.Table, report *table.Report, err error) error
+
+// Backfill scrapes past revisions of a Wikipedia article through the
+// MediaWiki API, oldest first, with the default Wikipedia scraper.
+type Backfill struct {
+	APIURL    string         // MediaWiki API endpoint, e.g. WikiAPIURL
+	Title     string         // article title, e.g. WikiTitle
+	Since     time.Time      // skip older revisions, all revisions if zero
+	Daily     bool           // only scrape the last revision of every day (UTC)
+	StateFile string         // last persisted revision, to resume from; not resumable if empty
+	Fetcher   *table.Fetcher // table.DefaultFetcher if nil
+}
+
+type revisionsResponse struct {
+	Continue map[string]string `json:"continue"`
+	Query    struct {
+		Pages []struct {
+			Title     string     `json:"title"`
+			Missing   bool       `json:"missing"`
+			Revisions []Revision `json:"revisions"`
+		} `json:"pages"`
+	} `json:"query"`
+	Error *apiError `json:"error"`
+}
+
+type parseResponse struct {
+	Parse struct {
+		RevID int64  `json:"revid"`
+		Text  string `json:"text"`
+	} `json:"parse"`
+	Error *apiError `json:"error"`
+}
+
+type apiError struct {
+	Code string `json:"code"`
+	Info string `json:"info"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("mediawiki API: %s: %s", e.Code, e.Info)
+}
+
+// Run scrapes all revisions after the one recorded in b.StateFile, or
+// since b.Since, and writes them to sink with the revision timestamp as
+// data date. Progress is saved after every revision, including those
+// that cannot be scraped, so that an interrupted backfill continues
+// where it stopped. Fetch and sink errors abort the backfill.
+func (b *Backfill) Run(ctx context.Context, sink table.Sink, fn BackfillFunc) error {
+	last, err := b.loadState()
+	if err != nil {
+		return err
+	}
+	revs, err := b.Revisions(ctx, last)
+	if err != nil {
+		return err
+	}
+	s, err := table.CompileScraper(newScraper(""))
+	if err != nil {
+		return err
+	}
+	for _, rev := range revs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		text, err := b.revisionText(ctx, rev)
+		var apiErr *apiError
+		if err != nil && !errors.As(err, &apiErr) {
+			return err
+		}
+		var t *table.Table
+		var report *table.Report
+		if err == nil {
+			t, report, err = b.scrape(s, rev, text)
+		}
+		if err == nil {
+			err = table.PersistToContext(ctx, sink, t)
+			if err != nil && !errors.Is(err, table.ErrUnchanged) {
+				return err
+			}
+		}
+		if err := fn(rev, t, report, err); err != nil {
+			return err
+		}
+		if err := b.saveState(rev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Revisions lists the revisions of b.Title after rev, or since b.Since
+// if rev is zero, oldest first.
+func (b *Backfill) Revisions(ctx context.Context, after Revision) ([]Revision, error) {
+	start := b.Since
+	if !after.Timestamp.IsZero() {
+		start = after.Timestamp
+	}
+	var revs []Revision
+	cont := map[string]string{}
+	for {
+		v := url.Values{
+			"action":        {"query"},
+			"prop":          {"revisions"},
+			"titles":        {b.Title},
+			"rvprop":        {"ids|timestamp"},
+			"rvlimit":       {"max"},
+			"rvdir":         {"newer"},
+			"redirects":     {"1"},
+			"format":        {"json"},
+			"formatversion": {"2"},
+		}
+		if !start.IsZero() {
+			v.Set("rvstart", start.UTC().Format(time.RFC3339))
+		}
+		for key, val := range cont {
+			v.Set(key, val)
+		}
+		var resp revisionsResponse
+		if err := b.fetchJSON(ctx, b.APIURL+"?"+v.Encode(), &resp); err != nil {
+			return nil, err
+		}
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		pages := resp.Query.Pages
+		if len(pages) != 1 || pages[0].Missing {
+			return nil, fmt.Errorf("no Wikipedia article '%s'", b.Title)
+		}
+		for _, rev := range pages[0].Revisions {
+			if rev.ID > after.ID {
+				revs = append(revs, rev)
+			}
+		}
+		if len(resp.Continue) == 0 {
+			break
+		}
+		cont = resp.Continue
+	}
+	if b.Daily {
+		revs = lastOfDay(revs, after)
+	}
+	return revs, nil
+}
+
+// lastOfDay returns the last revision of every day, skipping the day of
+// the already scraped revision after.
+func lastOfDay(revs []Revision, after Revision) []Revision {
+	var result []Revision
+	for i, rev := range revs {
+		if i+1 < len(revs) && sameDay(rev.Timestamp, revs[i+1].Timestamp) {
+			continue
+		}
+		if !after.Timestamp.IsZero() && sameDay(rev.Timestamp, after.Timestamp) {
+			continue
+		}
+		result = append(result, rev)
+	}
+	return result
+}
+
+func sameDay(t1, t2 time.Time) bool {
+	return t1.UTC().Format("2006-01-02") == t2.UTC().Format("2006-01-02")
+}
+
+func (b *Backfill) parseURL(rev Revision) string {
+	v := url.Values{
+		"action":        {"parse"},
+		"oldid":         {strconv.FormatInt(rev.ID, 10)},
+		"prop":          {"text"},
+		"format":        {"json"},
+		"formatversion": {"2"},
+	}
+	return b.APIURL + "?" + v.Encode()
+}
+
+// revisionText returns the HTML of rev. Revisions the API cannot render,
+// e.g. deleted ones, result in an *apiError.
+func (b *Backfill) revisionText(ctx context.Context, rev Revision) (string, error) {
+	var resp parseResponse
+	if err := b.fetchJSON(ctx, b.parseURL(rev), &resp); err != nil {
+		return "", err
+	}
+	if resp.Error != nil {
+		return "", resp.Error
+	}
+	return resp.Parse.Text, nil
+}
+
+func (b *Backfill) scrape(s *table.CompiledScraper, rev Revision, text string) (*table.Table, *table.Report, error) {
+	t, report, err := s.WithURL(b.parseURL(rev)).ScrapeReader(strings.NewReader(text))
+	if err != nil {
+		return nil, report, err
+	}
+	t.AsOf = rev.Timestamp
+	t.Run.Revision = strconv.FormatInt(rev.ID, 10)
+	return t, report, nil
+}
+
+func (b *Backfill) fetchJSON(ctx context.Context, u string, out interface{}) error {
+	fetcher := b.Fetcher
+	if fetcher == nil {
+		fetcher = table.DefaultFetcher
+	}
+	page, err := fetcher.Fetch(ctx, u)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(page.Body, out); err != nil {
+		return fmt.Errorf("GET %s: %w", u, err)
+	}
+	return nil
+}
+
+func (b *Backfill) loadState() (Revision, error) {
+	var rev Revision
+	if b.StateFile == "" {
+		return rev, nil
+	}
+	data, err := ioutil.ReadFile(b.StateFile)
+	if os.IsNotExist(err) {
+		return rev, nil
+	}
+	if err != nil {
+		return rev, err
+	}
+	if err := json.Unmarshal(data, &rev); err != nil {
+		return rev, fmt.Errorf("%s: %w", b.StateFile, err)
+	}
+	return rev, nil
+}
+
+// saveState records rev as scraped, replacing the state file atomically.
+func (b *Backfill) saveState(rev Revision) error {
+	if b.StateFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(rev)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(b.StateFile), "."+filepath.Base(b.StateFile)+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.StateFile)
+}
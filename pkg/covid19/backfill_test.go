@@ -0,0 +1,231 @@
+package covid19
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juliaogris/covid19/pkg/table"
+	"github.com/stretchr/testify/require"
+)
+
+type cannedRevision struct {
+	Revision
+	html string // page HTML, wikiPage if empty
+	err  string // API error code for action=parse
+}
+
+// wikiPage is the article as served on 2020-04-05, shared with the
+// covid19-scraper tests.
+var wikiPage = filepath.Join("..", "..", "cmd", "covid19-scraper", "testdata", "wikipedia_2020-04-05.htm")
+
+var cannedRevisions = []cannedRevision{
+	{Revision: Revision{ID: 1, Timestamp: date("2020-04-05T10:00:00Z")}},
+	{Revision: Revision{ID: 2, Timestamp: date("2020-04-05T17:03:01Z")}},
+	{Revision: Revision{ID: 3, Timestamp: date("2020-04-10T09:00:00Z")}, html: "<p>Vandalised</p>"},
+	{Revision: Revision{ID: 4, Timestamp: date("2020-04-18T12:00:00Z")}},
+	{Revision: Revision{ID: 5, Timestamp: date("2020-04-19T12:00:00Z")}, err: "nosuchrevid"},
+}
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// wikiAPI is a stand-in for the MediaWiki API serving cannedRevisions,
+// two per revision listing batch.
+type wikiAPI struct {
+	t      *testing.T
+	mu     sync.Mutex
+	parsed []int64 // oldids of action=parse requests
+}
+
+func (a *wikiAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	require.Equal(a.t, "2", q.Get("formatversion"))
+	var resp interface{}
+	switch q.Get("action") {
+	case "query":
+		resp = a.revisions(q.Get("titles"), q.Get("rvstart"), q.Get("rvcontinue"))
+	case "parse":
+		resp = a.parse(q.Get("oldid"))
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	require.NoError(a.t, json.NewEncoder(w).Encode(resp))
+}
+
+func (a *wikiAPI) revisions(title, rvstart, rvcontinue string) interface{} {
+	if title != WikiTitle {
+		return map[string]interface{}{"query": map[string]interface{}{
+			"pages": []interface{}{map[string]interface{}{"title": title, "missing": true}},
+		}}
+	}
+	var revs []Revision
+	for _, c := range cannedRevisions {
+		if rvstart == "" || !c.Timestamp.Before(date(rvstart)) {
+			revs = append(revs, c.Revision)
+		}
+	}
+	start, _ := strconv.Atoi(rvcontinue)
+	end := start + 2
+	resp := map[string]interface{}{}
+	if end < len(revs) {
+		resp["continue"] = map[string]string{"rvcontinue": strconv.Itoa(end), "continue": "||"}
+	} else {
+		end = len(revs)
+	}
+	resp["query"] = map[string]interface{}{
+		"pages": []interface{}{map[string]interface{}{"title": title, "revisions": revs[start:end]}},
+	}
+	return resp
+}
+
+func (a *wikiAPI) parse(oldid string) interface{} {
+	id, err := strconv.ParseInt(oldid, 10, 64)
+	require.NoError(a.t, err)
+	a.mu.Lock()
+	a.parsed = append(a.parsed, id)
+	a.mu.Unlock()
+	for _, c := range cannedRevisions {
+		if c.ID != id {
+			continue
+		}
+		if c.err != "" {
+			return map[string]interface{}{"error": map[string]string{"code": c.err, "info": "no such revision"}}
+		}
+		text := c.html
+		if text == "" {
+			b, err := ioutil.ReadFile(wikiPage)
+			require.NoError(a.t, err)
+			text = string(b)
+		}
+		return map[string]interface{}{"parse": map[string]interface{}{"revid": id, "text": text}}
+	}
+	return map[string]interface{}{"error": map[string]string{"code": "nosuchrevid", "info": "no such revision"}}
+}
+
+func newTestBackfill(t *testing.T) (*Backfill, *wikiAPI) {
+	t.Helper()
+	api := &wikiAPI{t: t}
+	ts := httptest.NewServer(api)
+	t.Cleanup(ts.Close)
+	dir, err := ioutil.TempDir("", "covid19-backfill")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	b := &Backfill{
+		APIURL:    ts.URL,
+		Title:     WikiTitle,
+		StateFile: filepath.Join(dir, "backfill.json"),
+		Fetcher:   table.NewFetcher(),
+	}
+	return b, api
+}
+
+func TestBackfill(t *testing.T) {
+	b, api := newTestBackfill(t)
+	sink := table.NewMemSink()
+	errs := map[int64]error{}
+	asOf := map[int64]time.Time{}
+	err := b.Run(context.Background(), sink, func(rev Revision, t *table.Table, report *table.Report, err error) error {
+		errs[rev.ID] = err
+		if t != nil {
+			asOf[rev.ID] = t.AsOf
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 2, 3, 4, 5}, api.parsed)
+	require.NoError(t, errs[1])
+	require.NoError(t, errs[2])
+	require.Error(t, errs[3])
+	require.NoError(t, errs[4])
+	require.Error(t, errs[5])
+
+	runs := sink.Runs()
+	require.Equal(t, 3, len(runs))
+	require.Equal(t, "4", runs[2].Revision)
+	require.Contains(t, runs[2].URL, "oldid=4")
+	require.Equal(t, 3*220, len(sink.Table("entries").Cells))
+	require.Equal(t, cannedRevisions[3].Timestamp, asOf[4])
+
+	// nothing left to do
+	api.parsed = nil
+	require.NoError(t, b.Run(context.Background(), sink, func(Revision, *table.Table, *table.Report, error) error {
+		return nil
+	}))
+	require.Empty(t, api.parsed)
+}
+
+func TestBackfillResume(t *testing.T) {
+	b, api := newTestBackfill(t)
+	errStop := errors.New("stop")
+	stop := true
+	fn := func(rev Revision, _ *table.Table, _ *table.Report, _ error) error {
+		if rev.ID == 2 && stop {
+			stop = false
+			return errStop
+		}
+		return nil
+	}
+	err := b.Run(context.Background(), table.NewMemSink(), fn)
+	require.True(t, errors.Is(err, errStop))
+	require.Equal(t, []int64{1, 2}, api.parsed)
+
+	api.parsed = nil
+	require.NoError(t, b.Run(context.Background(), table.NewMemSink(), fn))
+	require.Equal(t, []int64{2, 3, 4, 5}, api.parsed)
+
+	last, err := b.loadState()
+	require.NoError(t, err)
+	require.Equal(t, cannedRevisions[4].Revision, last)
+}
+
+func TestBackfillRevisions(t *testing.T) {
+	b, _ := newTestBackfill(t)
+	tests := map[string]struct {
+		since time.Time
+		daily bool
+		after Revision
+		want  []int64
+	}{
+		"all":          {want: []int64{1, 2, 3, 4, 5}},
+		"since":        {since: date("2020-04-10T00:00:00Z"), want: []int64{3, 4, 5}},
+		"after":        {after: cannedRevisions[1].Revision, want: []int64{3, 4, 5}},
+		"daily":        {daily: true, want: []int64{2, 3, 4, 5}},
+		"daily_after":  {daily: true, after: cannedRevisions[0].Revision, want: []int64{3, 4, 5}},
+		"after_since":  {since: date("2020-04-18T00:00:00Z"), after: cannedRevisions[1].Revision, want: []int64{3, 4, 5}},
+		"since_future": {since: date("2021-01-01T00:00:00Z")},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			b.Since = tc.since
+			b.Daily = tc.daily
+			revs, err := b.Revisions(context.Background(), tc.after)
+			require.NoError(t, err)
+			var got []int64
+			for _, rev := range revs {
+				got = append(got, rev.ID)
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+
+	b.Title = "No such article"
+	_, err := b.Revisions(context.Background(), Revision{})
+	require.Error(t, err)
+}
@@ -1,7 +1,9 @@
 package covid19
 
 import (
-	"reflect"
+	"context"
+	"errors"
+	"fmt"
 
 	"github.com/juliaogris/covid19/pkg/table"
 )
@@ -15,10 +17,10 @@ func newScraper(url string) *table.Scraper {
 		CSSSelector: "div#covid19-container table.wikitable",
 		ColumnDefs: []table.ColumnDef{
 			{Skip: true},
-			{TargetName: "country", Type: reflect.String, TruncateFrom: "["},
-			{TargetName: "cases", Type: reflect.Int, ZeroValues: dashes},
-			{TargetName: "deaths", Type: reflect.Int, ZeroValues: dashes},
-			{TargetName: "recoveries", Type: reflect.Int, ZeroValues: dashes},
+			{TargetName: "country", Type: table.StringType, TruncateFrom: "["},
+			{TargetName: "cases", Type: table.IntType, ZeroValues: dashes},
+			{TargetName: "deaths", Type: table.IntType, ZeroValues: dashes},
+			{TargetName: "recoveries", Type: table.IntType, ZeroValues: dashes},
 			{Skip: true},
 		},
 		HeaderRowIndex:  0,
@@ -27,16 +29,90 @@ func newScraper(url string) *table.Scraper {
 		FooterRowCount:  2,
 		TargetTableName: "entries",
 		ContinueOnError: true,
+		Version:         "1",
+		RevisionPattern: `"wgRevisionId":([0-9]+)`,
+
+		AsOfCSSSelector:  "div#covid19-container",
+		AsOfPattern:      `As of ([0-9]+ [A-Za-z]+ [0-9]{4})`,
+		AsOfLayout:       "2 January 2006",
+		AsOfLastModified: true,
+	}
+}
+
+func ScrapeWiki(url string, sink table.Sink) (*table.Table, *table.Report, error) {
+	return ScrapeWikiContext(context.Background(), url, sink)
+}
+
+func ScrapeWikiContext(ctx context.Context, url string, sink table.Sink) (*table.Table, *table.Report, error) {
+	s, err := table.CompileScraper(newScraper(url))
+	if err != nil {
+		return nil, nil, err
+	}
+	return ScrapeContext(ctx, s, sink)
+}
+
+func Scrape(s *table.CompiledScraper, sink table.Sink) (*table.Table, *table.Report, error) {
+	return ScrapeContext(context.Background(), s, sink)
+}
+
+// ScrapeContext scrapes s and writes the result to sink, aborting both
+// when ctx is done.
+func ScrapeContext(ctx context.Context, s *table.CompiledScraper, sink table.Sink) (*table.Table, *table.Report, error) {
+	t, report, err := s.ScrapeContext(ctx)
+	if err != nil {
+		return nil, report, err
+	}
+	if err := table.PersistToContext(ctx, sink, t); err != nil {
+		if !errors.Is(err, table.ErrUnchanged) {
+			// fetch again next time rather than skip the unpersisted page
+			s.Forget()
+		}
+		return nil, report, err
+	}
+	return t, report, nil
+}
+
+// ReplayFunc is called by ReplayContext with the outcome of every
+// archived page. Replaying stops if it returns an error.
+type ReplayFunc func(e table.ArchiveEntry, t *table.Table, report *table.Report, err error) error
+
+// ReplayWikiContext replays the archived pages of the Wikipedia article
+// at url with the default Wikipedia scraper, see ReplayContext.
+func ReplayWikiContext(ctx context.Context, url string, archive *table.Archive, sink table.Sink, fn ReplayFunc) error {
+	s, err := table.CompileScraper(newScraper(url))
+	if err != nil {
+		return err
 	}
+	return ReplayContext(ctx, s, archive, sink, fn)
 }
 
-func ScrapeWiki(url, conn string) (*table.Table, error) {
-	t, err := newScraper(url).Scrape()
+// ReplayContext scrapes all archived pages of the scraper URL, oldest
+// first, and writes every table to sink, e.g. to re-parse history after
+// fixing a scraper definition.
+func ReplayContext(ctx context.Context, s *table.CompiledScraper, archive *table.Archive, sink table.Sink, fn ReplayFunc) error {
+	u := s.Scraper().URL
+	entries, err := archive.Entries(u)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no archived pages for %s", u)
 	}
-	if err := table.Persist(conn, t); err != nil {
-		return nil, err
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		page, err := archive.Page(e)
+		if err != nil {
+			return err
+		}
+		t, report, err := s.ScrapePage(page)
+		if err == nil {
+			err = table.PersistToContext(ctx, sink, t)
+		}
+		if err := fn(e, t, report, err); err != nil {
+			return err
+		}
 	}
-	return t, nil
+	return nil
 }
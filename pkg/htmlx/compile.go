@@ -0,0 +1,79 @@
+package htmlx
+
+import (
+	"fmt"
+
+	"golang.org/x/net/html"
+)
+
+// CompiledSelector is a parsed CSS selector that can be used for any
+// number of queries, e.g. compiled once when loading a configuration.
+type CompiledSelector struct {
+	source string
+	group  Group
+}
+
+// Compile parses a CSS selector. Parse errors are of type *SelectorError.
+func Compile(selector string) (*CompiledSelector, error) {
+	g, err := ParseGroup(selector)
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledSelector{source: selector, group: g}, nil
+}
+
+// MustCompile is like Compile but panics if the selector cannot be parsed.
+func MustCompile(selector string) *CompiledSelector {
+	c, err := Compile(selector)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// String returns the source text of the selector.
+func (c *CompiledSelector) String() string {
+	return c.source
+}
+
+func (c *CompiledSelector) Group() Group {
+	return c.group
+}
+
+// Match reports whether n matches the selector.
+func (c *CompiledSelector) Match(n *html.Node) bool {
+	return n.Type == html.ElementNode && c.group.Match(n)
+}
+
+// Query returns the first element in document order within n, including
+// n, that matches the selector, or nil if none matches.
+func (c *CompiledSelector) Query(n *html.Node) *html.Node {
+	return QueryGroup(n, c.group)
+}
+
+// QueryAll returns all elements within n, including n, that match the
+// selector in document order.
+func (c *CompiledSelector) QueryAll(n *html.Node) []*html.Node {
+	return QueryGroupAll(n, c.group)
+}
+
+// SelectorError reports where parsing a selector failed.
+type SelectorError struct {
+	Selector string
+	Offset   int    // byte offset of Token in Selector
+	Token    string // offending token, empty at end of input
+	Msg      string
+	Err      error // ErrInvalidSelector, ErrInvalidTag or ErrDuplicateID
+}
+
+func (e *SelectorError) Error() string {
+	near := fmt.Sprintf("near %q", e.Token)
+	if e.Token == "" {
+		near = "(end of input)"
+	}
+	return fmt.Sprintf("%v at offset %d %s in %q: %s", e.Err, e.Offset, near, e.Selector, e.Msg)
+}
+
+func (e *SelectorError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,60 @@
+package htmlx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompile(t *testing.T) {
+	c, err := Compile("div#main table.wikitable, td:empty")
+	require.NoError(t, err)
+	require.Equal(t, "div#main table.wikitable, td:empty", c.String())
+
+	for i := 0; i < 2; i++ {
+		doc := parseTestDoc(t)
+		require.Equal(t, []string{"t1", "c4"}, ids(c.QueryAll(doc)))
+		require.True(t, c.Match(c.Query(doc)))
+	}
+
+	require.Panics(t, func() { MustCompile("div >") })
+}
+
+func TestSelectorError(t *testing.T) {
+	tests := []struct {
+		input  string
+		offset int
+		token  string
+		want   error
+		msg    string
+	}{
+		{input: "div >", offset: 5, token: "", want: ErrInvalidSelector,
+			msg: `invalid selector at offset 5 (end of input) in "div >": expected selector`},
+		{input: "div.x$2", offset: 5, token: "$", want: ErrInvalidSelector,
+			msg: `invalid selector at offset 5 near "$" in "div.x$2": unexpected character`},
+		{input: "div > p100.x", offset: 6, token: "p100", want: ErrInvalidTag,
+			msg: `invalid tag at offset 6 near "p100" in "div > p100.x": unknown tag`},
+		{input: "#a#b", offset: 2, token: "#", want: ErrDuplicateID,
+			msg: `duplicate id at offset 2 near "#" in "#a#b": second id in compound selector`},
+		{input: "tr:nth(2)", offset: 2, token: ":", want: ErrInvalidSelector,
+			msg: `invalid selector at offset 2 near ":" in "tr:nth(2)": unknown pseudo-class`},
+		{input: "td:nth-child(2x)", offset: 13, token: "2x", want: ErrInvalidSelector,
+			msg: `invalid selector at offset 13 near "2x" in "td:nth-child(2x)": invalid nth expression`},
+		{input: "a[href='x]", offset: 10, token: "", want: ErrInvalidSelector,
+			msg: `invalid selector at offset 10 (end of input) in "a[href='x]": unterminated string`},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := Compile(tc.input)
+			ErrorIs(t, tc.want, err)
+			var serr *SelectorError
+			require.True(t, errors.As(err, &serr))
+			require.Equal(t, tc.input, serr.Selector)
+			require.Equal(t, tc.offset, serr.Offset)
+			require.Equal(t, tc.token, serr.Token)
+			require.Equal(t, tc.msg, err.Error())
+		})
+	}
+}
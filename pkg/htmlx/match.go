@@ -0,0 +1,239 @@
+package htmlx
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Match reports whether n matches any selector of the group.
+func (g Group) Match(n *html.Node) bool {
+	for _, c := range g {
+		if c.Match(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether n matches the complex selector. Combinators are
+// evaluated against the whole document n is part of.
+func (c *Complex) Match(n *html.Node) bool {
+	return c.match(n, len(c.Compounds)-1, nil)
+}
+
+// match matches n against Compounds[i] and the compounds before it. If
+// anchor is not nil the element matching Compounds[0] must satisfy it.
+func (c *Complex) match(n *html.Node, i int, anchor func(*html.Node) bool) bool {
+	if !Match(n, c.Compounds[i]) {
+		return false
+	}
+	if i == 0 {
+		return anchor == nil || anchor(n)
+	}
+	switch c.Combinators[i-1] {
+	case Child:
+		p := n.Parent
+		return p != nil && c.match(p, i-1, anchor)
+	case Adjacent:
+		s := prevElement(n)
+		return s != nil && c.match(s, i-1, anchor)
+	case Sibling:
+		for s := prevElement(n); s != nil; s = prevElement(s) {
+			if c.match(s, i-1, anchor) {
+				return true
+			}
+		}
+	default:
+		for p := n.Parent; p != nil; p = p.Parent {
+			if c.match(p, i-1, anchor) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchRelative reports whether the :has() argument c matches relative
+// to n, e.g. "> p" matches if n has a p child.
+func (c *Complex) matchRelative(n *html.Node) bool {
+	var anchor func(*html.Node) bool
+	var candidates []*html.Node
+	switch c.Relative {
+	case Child:
+		anchor = func(m *html.Node) bool { return m.Parent == n }
+	case Adjacent:
+		anchor = func(m *html.Node) bool { return prevElement(m) == n }
+	case Sibling:
+		anchor = func(m *html.Node) bool { return isFollowingSibling(n, m) }
+	default:
+		anchor = func(m *html.Node) bool { return isAncestor(n, m) }
+	}
+	if c.Relative == Adjacent || c.Relative == Sibling {
+		for s := nextElement(n); s != nil; s = nextElement(s) {
+			candidates = append(candidates, s)
+			candidates = append(candidates, descendants(s)...)
+		}
+	} else {
+		candidates = descendants(n)
+	}
+	last := len(c.Compounds) - 1
+	for _, m := range candidates {
+		if c.match(m, last, anchor) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAttr(n *html.Node, a Attr) bool {
+	for _, na := range n.Attr {
+		if na.Key == a.Key {
+			return matchAttrVal(na.Val, a)
+		}
+	}
+	return false
+}
+
+func matchAttrVal(val string, a Attr) bool {
+	want := a.Val
+	if a.CaseInsensitive {
+		val, want = strings.ToLower(val), strings.ToLower(want)
+	}
+	switch a.Op {
+	case "":
+		return true
+	case "=":
+		return val == want
+	case "~=":
+		return contains(strings.Fields(val), want)
+	case "|=":
+		return val == want || strings.HasPrefix(val, want+"-")
+	case "^=":
+		return want != "" && strings.HasPrefix(val, want)
+	case "$=":
+		return want != "" && strings.HasSuffix(val, want)
+	case "*=":
+		return want != "" && strings.Contains(val, want)
+	}
+	return false
+}
+
+func matchPseudo(n *html.Node, p Pseudo) bool {
+	switch p.Name {
+	case "first-child":
+		return prevElement(n) == nil
+	case "last-child":
+		return nextElement(n) == nil
+	case "only-child":
+		return prevElement(n) == nil && nextElement(n) == nil
+	case "first-of-type":
+		return countSiblings(n, true, false) == 1
+	case "last-of-type":
+		return countSiblings(n, true, true) == 1
+	case "only-of-type":
+		return countSiblings(n, true, false) == 1 && countSiblings(n, true, true) == 1
+	case "nth-child":
+		return matchNth(countSiblings(n, false, false), p.A, p.B)
+	case "nth-last-child":
+		return matchNth(countSiblings(n, false, true), p.A, p.B)
+	case "nth-of-type":
+		return matchNth(countSiblings(n, true, false), p.A, p.B)
+	case "nth-last-of-type":
+		return matchNth(countSiblings(n, true, true), p.A, p.B)
+	case "empty":
+		return isEmpty(n)
+	case "root":
+		return n.Parent != nil && n.Parent.Type == html.DocumentNode
+	case "not":
+		return !p.Group.Match(n)
+	case "has":
+		for _, c := range p.Group {
+			if c.matchRelative(n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// countSiblings returns the 1-based position of n among its element
+// siblings, optionally only those of the same type and counting from the end.
+func countSiblings(n *html.Node, sameType, fromEnd bool) int {
+	next := prevElement
+	if fromEnd {
+		next = nextElement
+	}
+	pos := 1
+	for s := next(n); s != nil; s = next(s) {
+		if !sameType || s.Data == n.Data {
+			pos++
+		}
+	}
+	return pos
+}
+
+// matchNth reports whether pos = a*k + b for some k >= 0.
+func matchNth(pos, a, b int) bool {
+	if a == 0 {
+		return pos == b
+	}
+	k := (pos - b) / a
+	return k >= 0 && (pos-b)%a == 0
+}
+
+func isEmpty(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode || (c.Type == html.TextNode && c.Data != "") {
+			return false
+		}
+	}
+	return true
+}
+
+func prevElement(n *html.Node) *html.Node {
+	for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+func nextElement(n *html.Node) *html.Node {
+	for s := n.NextSibling; s != nil; s = s.NextSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+func isFollowingSibling(n, m *html.Node) bool {
+	for s := nextElement(n); s != nil; s = nextElement(s) {
+		if s == m {
+			return true
+		}
+	}
+	return false
+}
+
+func isAncestor(a, n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p == a {
+			return true
+		}
+	}
+	return false
+}
+
+func descendants(n *html.Node) []*html.Node {
+	var result []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			result = append(result, c)
+		}
+		result = append(result, descendants(c)...)
+	}
+	return result
+}
@@ -0,0 +1,206 @@
+package htmlx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+const testDoc = `<html id="doc"><body>
+<div id="main" class="content wide">
+  <h2 id="h-cases">By country</h2>
+  <p id="p1">intro</p>
+  <table id="t1" class="wikitable sortable" data-x="1">
+    <tr id="r1"><th id="c1">Country</th><td id="c2" data-sort-value="7">7</td></tr>
+    <tr id="r2"><th id="c3">Italy</th><td id="c4"></td></tr>
+    <tr id="r3"><th id="c5">Spain</th><td id="c6"><a id="a1" href="/wiki/Spain" lang="en-GB">Spain</a></td></tr>
+  </table>
+  <p id="p2">outro</p>
+  <span id="s1"></span>
+</div>
+<div id="other" class="table_container">
+  <table id="t2" class="legend"><tr id="r4"><td id="c7">x</td></tr></table>
+</div>
+</body></html>`
+
+func parseTestDoc(t *testing.T) *html.Node {
+	t.Helper()
+	n, err := html.Parse(strings.NewReader(testDoc))
+	require.NoError(t, err)
+	return n
+}
+
+func ids(nodes []*html.Node) []string {
+	result := make([]string, len(nodes))
+	for i, n := range nodes {
+		for _, a := range n.Attr {
+			if a.Key == "id" {
+				result[i] = a.Val
+			}
+		}
+	}
+	return result
+}
+
+func queryGroupAll(t *testing.T, n *html.Node, selector string) []string {
+	t.Helper()
+	nodes, err := QuerySelectorAll(n, selector)
+	require.NoError(t, err)
+	return ids(nodes)
+}
+
+func TestGroupMatch(t *testing.T) {
+	doc := parseTestDoc(t)
+	tests := map[string][]string{
+		"div#main > table":            {"t1"},
+		"body > table":                nil,
+		"h2 + p":                      {"p1"},
+		"h2 ~ p":                      {"p1", "p2"},
+		"table ~ span":                {"s1"},
+		"h2, span":                    {"h-cases", "s1"},
+		"[data-x]":                    {"t1"},
+		"td[data-sort-value='7']":     {"c2"},
+		"a[href^=\"/wiki\"]":          {"a1"},
+		"a[href$=Spain]":              {"a1"},
+		"a[href*=iki]":                {"a1"},
+		"a[lang|=en]":                 {"a1"},
+		"table[class~=sortable]":      {"t1"},
+		"table[class~=sort]":          nil,
+		"table[CLASS~=WIKITABLE i]":   {"t1"},
+		"tr:nth-child(2)":             {"r2"},
+		"tr:nth-child(odd)":           {"r1", "r3", "r4"},
+		"tr:nth-child(-n+2) > th":     {"c1", "c3"},
+		"tr:nth-last-child(1)":        {"r3", "r4"},
+		"tr:first-child td":           {"c2", "c7"},
+		"tr:last-child > *":           {"c5", "c6", "c7"},
+		"div#main p:first-of-type":    {"p1"},
+		"div#main p:last-of-type":     {"p2"},
+		"div#main > :nth-of-type(2)":  {"p2"},
+		"div > table:only-of-type":    {"t1", "t2"},
+		"td:only-child":               {"c7"},
+		"td:empty":                    {"c4"},
+		"tr:not(:first-child) > th":   {"c3", "c5"},
+		"table:not(.legend, #none)":   {"t1"},
+		"div:has(table.legend)":       {"other"},
+		"tr:has(> td > a)":            {"r3"},
+		"h2:has(+ p)":                 {"h-cases"},
+		"h2:has(~ span)":              {"h-cases"},
+		"p:has(~ table td:empty)":     {"p1"},
+		"div:has(h2) table tr > th":   {"c1", "c3", "c5"},
+		"*:root":                      {"doc"},
+		"html:root":                   {"doc"},
+		"div#main table.wikitable tr": {"r1", "r2", "r3"},
+		".table":                      nil,
+		".wiki":                       nil,
+		".table_container":            {"other"},
+		"table.sortable.wikitable":    {"t1"},
+		"table":                       {"t1", "t2"},
+		"table:nth-of-type(1) ~ p":    {"p2"},
+	}
+	for selector, want := range tests {
+		selector, want := selector, want
+		t.Run(selector, func(t *testing.T) {
+			got := queryGroupAll(t, doc, selector)
+			if want == nil {
+				want = []string{}
+			}
+			require.Equal(t, want, got)
+		})
+	}
+}
+
+func TestQuerySelector(t *testing.T) {
+	doc := parseTestDoc(t)
+	n, err := QuerySelector(doc, "div#main table.wikitable")
+	require.NoError(t, err)
+	require.Equal(t, []string{"t1"}, ids([]*html.Node{n}))
+
+	n, err = QuerySelector(doc, "div.table_container > table, td:empty")
+	require.NoError(t, err)
+	require.Equal(t, []string{"c4"}, ids([]*html.Node{n}))
+
+	n, err = QuerySelector(doc, "ul > li")
+	require.NoError(t, err)
+	require.Nil(t, n)
+}
+
+func TestParseGroup(t *testing.T) {
+	g, err := ParseGroup("div#main > table.a[data-x='1' i]:nth-child(2n+1) td, :not(p) ~ a")
+	require.NoError(t, err)
+	want := Group{
+		{
+			Compounds: []*Selector{
+				{Tag: "div", ID: "main"},
+				{Tag: "table", Classes: []string{"a"}, Attrs: []Attr{{Key: "data-x", Op: "=", Val: "1", CaseInsensitive: true}},
+					Pseudos: []Pseudo{{Name: "nth-child", A: 2, B: 1}}},
+				{Tag: "td"},
+			},
+			Combinators: []Combinator{Child, Descendant},
+		},
+		{
+			Compounds: []*Selector{
+				{Pseudos: []Pseudo{{Name: "not", Group: Group{{Compounds: []*Selector{{Tag: "p"}}}}}}},
+				{Tag: "a"},
+			},
+			Combinators: []Combinator{Sibling},
+		},
+	}
+	require.Equal(t, want, g)
+}
+
+func TestParseNth(t *testing.T) {
+	tests := map[string][2]int{
+		"odd": {2, 1}, "even": {2, 0}, "3": {0, 3}, "n": {1, 0}, "-n+3": {-1, 3},
+		"2n": {2, 0}, "2n+1": {2, 1}, " 3n - 2 ": {3, -2}, "+n+1": {1, 1},
+	}
+	for input, want := range tests {
+		a, b, err := parseNth(input)
+		require.NoError(t, err, input)
+		require.Equal(t, want, [2]int{a, b}, input)
+	}
+	for _, input := range []string{"", "x", "2n1", "n+", "2.5n"} {
+		_, _, err := parseNth(input)
+		require.Error(t, err, input)
+	}
+}
+
+func TestParseGroupErr(t *testing.T) {
+	tests := map[string]error{
+		"":                ErrInvalidSelector,
+		"div >":           ErrInvalidSelector,
+		"> div":           ErrInvalidSelector,
+		"div,":            ErrInvalidSelector,
+		"div ,, p":        ErrInvalidSelector,
+		"[x":              ErrInvalidSelector,
+		"[x=]":            ErrInvalidSelector,
+		"[x='y]":          ErrInvalidSelector,
+		"[x!=y]":          ErrInvalidSelector,
+		":nth-child(x)":   ErrInvalidSelector,
+		":unknown":        ErrInvalidSelector,
+		":not(p":          ErrInvalidSelector,
+		":first-child(1)": ErrInvalidSelector,
+		"div$":            ErrInvalidSelector,
+		"#a#b":            ErrDuplicateID,
+		"p100 > a":        ErrInvalidTag,
+	}
+	for input, want := range tests {
+		input, want := input, want
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseGroup(input)
+			ErrorIs(t, want, err)
+		})
+	}
+}
+
+func TestQuerySelectorAllOrder(t *testing.T) {
+	doc := parseTestDoc(t)
+	nodes, err := QuerySelectorAll(doc, "td, th, tr")
+	require.NoError(t, err)
+	want := []string{"r1", "c1", "c2", "r2", "c3", "c4", "r3", "c5", "c6", "r4", "c7"}
+	require.Equal(t, want, ids(nodes))
+
+	_, err = QuerySelectorAll(doc, "td >")
+	ErrorIs(t, ErrInvalidSelector, err)
+}
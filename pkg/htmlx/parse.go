@@ -0,0 +1,408 @@
+package htmlx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Group is a comma separated list of complex selectors, e.g. "h2, h3 > a".
+// It matches elements matching any of its selectors.
+type Group []*Complex
+
+// Complex is a chain of compound selectors joined by combinators, e.g.
+// "div#main > table.wikitable tr".
+type Complex struct {
+	Compounds   []*Selector
+	Combinators []Combinator // Combinators[i] joins Compounds[i] and Compounds[i+1]
+	Relative    Combinator   // leading combinator of :has() arguments, e.g. "> p"
+}
+
+type Combinator byte
+
+const (
+	Descendant Combinator = ' '
+	Child      Combinator = '>'
+	Adjacent   Combinator = '+'
+	Sibling    Combinator = '~'
+)
+
+// Attr is an attribute selector, e.g. [data-x], [href^="/wiki"] or
+// [class~=big i].
+type Attr struct {
+	Key             string
+	Op              string // "", "=", "~=", "|=", "^=", "$=" or "*="
+	Val             string
+	CaseInsensitive bool
+}
+
+// Pseudo is a pseudo-class, e.g. :first-child, :nth-child(2n+1) or
+// :not(.hidden).
+type Pseudo struct {
+	Name  string
+	A, B  int   // for :nth-*(an+b)
+	Group Group // for :not() and :has()
+}
+
+var pseudoArgs = map[string]string{
+	"first-child":      "",
+	"last-child":       "",
+	"only-child":       "",
+	"first-of-type":    "",
+	"last-of-type":     "",
+	"only-of-type":     "",
+	"empty":            "",
+	"root":             "",
+	"nth-child":        "nth",
+	"nth-last-child":   "nth",
+	"nth-of-type":      "nth",
+	"nth-last-of-type": "nth",
+	"not":              "group",
+	"has":              "relative",
+}
+
+// ParseGroup parses a full CSS selector, e.g. "div > p.x, ul li:nth-child(odd)".
+func ParseGroup(s string) (Group, error) {
+	p := &parser{s: s}
+	g, err := p.parseGroup(false, false)
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, p.errorf("unexpected character")
+	}
+	return g, nil
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *parser) skipSpace() bool {
+	start := p.pos
+	for !p.done() && isSpace(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return p.errorAt(p.pos, ErrInvalidSelector, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) errorAt(pos int, err error, msg string) error {
+	return &SelectorError{Selector: p.s, Offset: pos, Token: p.tokenAt(pos), Msg: msg, Err: err}
+}
+
+// tokenAt returns the identifier or single character starting at pos.
+func (p *parser) tokenAt(pos int) string {
+	if pos >= len(p.s) {
+		return ""
+	}
+	end := pos + 1
+	if isIdentChar(p.s[pos]) {
+		for end < len(p.s) && isIdentChar(p.s[end]) {
+			end++
+		}
+	}
+	return p.s[pos:end]
+}
+
+func (p *parser) parseGroup(nested, relative bool) (Group, error) {
+	var g Group
+	for {
+		p.skipSpace()
+		c, err := p.parseComplex(relative)
+		if err != nil {
+			return nil, err
+		}
+		g = append(g, c)
+		p.skipSpace()
+		switch {
+		case p.peek() == ',':
+			p.pos++
+		case p.done() || (nested && p.peek() == ')'):
+			return g, nil
+		default:
+			return nil, p.errorf("unexpected character")
+		}
+	}
+}
+
+func (p *parser) parseComplex(relative bool) (*Complex, error) {
+	c := &Complex{}
+	if relative {
+		if comb, ok := p.parseCombinator(); ok {
+			c.Relative = comb
+			p.skipSpace()
+		}
+	}
+	for {
+		sel, err := p.parseCompound()
+		if err != nil {
+			return nil, err
+		}
+		c.Compounds = append(c.Compounds, sel)
+		space := p.skipSpace()
+		comb, ok := p.parseCombinator()
+		if !ok {
+			if !space || p.done() || p.peek() == ',' || p.peek() == ')' {
+				return c, nil
+			}
+			comb = Descendant
+		}
+		p.skipSpace()
+		c.Combinators = append(c.Combinators, comb)
+	}
+}
+
+func (p *parser) parseCombinator() (Combinator, bool) {
+	switch c := Combinator(p.peek()); c {
+	case Child, Adjacent, Sibling:
+		p.pos++
+		return c, true
+	}
+	return 0, false
+}
+
+func (p *parser) parseCompound() (*Selector, error) {
+	s := &Selector{}
+	start := p.pos
+	switch {
+	case p.peek() == '*':
+		p.pos++
+		s.Tag = "*"
+	case isIdentStart(p.peek()):
+		s.Tag = strings.ToLower(p.parseIdent())
+		if !validTag[s.Tag] {
+			return nil, p.errorAt(start, ErrInvalidTag, "unknown tag")
+		}
+	}
+	for !p.done() {
+		var err error
+		switch p.peek() {
+		case '#':
+			err = p.parseID(s)
+		case '.':
+			p.pos++
+			class := p.parseIdent()
+			if class == "" {
+				return nil, p.errorf("expected class name")
+			}
+			s.Classes = append(s.Classes, class)
+		case '[':
+			err = p.parseAttr(s)
+		case ':':
+			err = p.parsePseudo(s)
+		default:
+			if p.pos == start {
+				return nil, p.errorf("unexpected character")
+			}
+			return s, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.pos == start {
+		return nil, p.errorf("expected selector")
+	}
+	return s, nil
+}
+
+func (p *parser) parseID(s *Selector) error {
+	start := p.pos
+	p.pos++
+	id := p.parseIdent()
+	if id == "" {
+		return p.errorf("expected id")
+	}
+	if s.ID != "" {
+		return p.errorAt(start, ErrDuplicateID, "second id in compound selector")
+	}
+	s.ID = id
+	return nil
+}
+
+func (p *parser) parseIdent() string {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	if !isIdentStart(p.peek()) {
+		p.pos = start
+		return ""
+	}
+	for !p.done() && isIdentChar(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *parser) parseAttr(s *Selector) error {
+	p.pos++
+	p.skipSpace()
+	a := Attr{Key: strings.ToLower(p.parseIdent())}
+	if a.Key == "" {
+		return p.errorf("expected attribute name")
+	}
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.pos++
+		s.Attrs = append(s.Attrs, a)
+		return nil
+	}
+	for _, op := range []string{"=", "~=", "|=", "^=", "$=", "*="} {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			a.Op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if a.Op == "" {
+		return p.errorf("expected attribute operator")
+	}
+	p.skipSpace()
+	val, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	a.Val = val
+	if p.skipSpace() && (p.peek() == 'i' || p.peek() == 'I' || p.peek() == 's' || p.peek() == 'S') {
+		a.CaseInsensitive = p.peek() == 'i' || p.peek() == 'I'
+		p.pos++
+		p.skipSpace()
+	}
+	if p.peek() != ']' {
+		return p.errorf("expected ']'")
+	}
+	p.pos++
+	s.Attrs = append(s.Attrs, a)
+	return nil
+}
+
+func (p *parser) parseValue() (string, error) {
+	q := p.peek()
+	if q != '"' && q != '\'' {
+		if v := p.parseIdent(); v != "" {
+			return v, nil
+		}
+		return "", p.errorf("expected attribute value")
+	}
+	p.pos++
+	var sb strings.Builder
+	for !p.done() {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == q:
+			return sb.String(), nil
+		case c == '\\' && !p.done():
+			sb.WriteByte(p.s[p.pos])
+			p.pos++
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *parser) parsePseudo(s *Selector) error {
+	start := p.pos
+	p.pos++
+	name := strings.ToLower(p.parseIdent())
+	args, ok := pseudoArgs[name]
+	if !ok {
+		return p.errorAt(start, ErrInvalidSelector, "unknown pseudo-class")
+	}
+	ps := Pseudo{Name: name}
+	if args == "" {
+		s.Pseudos = append(s.Pseudos, ps)
+		return nil
+	}
+	if p.peek() != '(' {
+		return p.errorf("expected '(' after ':%s'", name)
+	}
+	p.pos++
+	var err error
+	if args == "nth" {
+		end := strings.IndexByte(p.s[p.pos:], ')')
+		if end == -1 {
+			return p.errorf("expected ')'")
+		}
+		ps.A, ps.B, err = parseNth(p.s[p.pos : p.pos+end])
+		if err != nil {
+			return p.errorf("invalid nth expression")
+		}
+		p.pos += end
+	} else {
+		if ps.Group, err = p.parseGroup(true, args == "relative"); err != nil {
+			return err
+		}
+	}
+	if p.peek() != ')' {
+		return p.errorf("expected ')'")
+	}
+	p.pos++
+	s.Pseudos = append(s.Pseudos, ps)
+	return nil
+}
+
+// parseNth parses the an+b argument of :nth-child() and friends.
+func parseNth(s string) (a, b int, err error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	switch s {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+	i := strings.IndexByte(s, 'n')
+	if i == -1 {
+		b, err = strconv.Atoi(s)
+		return 0, b, err
+	}
+	switch as := s[:i]; as {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		if a, err = strconv.Atoi(as); err != nil {
+			return 0, 0, err
+		}
+	}
+	if bs := s[i+1:]; bs != "" {
+		if bs[0] != '+' && bs[0] != '-' {
+			return 0, 0, fmt.Errorf("invalid nth expression '%s'", s)
+		}
+		if b, err = strconv.Atoi(bs); err != nil {
+			return 0, 0, err
+		}
+	}
+	return a, b, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c == '-' || (c >= '0' && c <= '9')
+}
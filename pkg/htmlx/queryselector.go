@@ -2,7 +2,6 @@ package htmlx
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 
 	"golang.org/x/net/html"
@@ -14,15 +13,55 @@ var (
 	ErrInvalidTag      = fmt.Errorf("invalid tag")
 )
 
+// QuerySelector returns the first element in document order within n,
+// including n, that matches the CSS selector, or nil if none matches.
+// The selector is parsed for every call, use Compile for repeated queries.
 func QuerySelector(n *html.Node, selector string) (*html.Node, error) {
-	s, err := ParseSelectors(selector)
+	c, err := Compile(selector)
 	if err != nil {
 		return nil, err
 	}
-	if len(s) > 1 {
-		return QueryNested(n, s), nil
+	return c.Query(n), nil
+}
+
+// QuerySelectorAll returns all elements within n, including n, that match
+// the CSS selector in document order. The selector is parsed for every
+// call, use Compile for repeated queries.
+func QuerySelectorAll(n *html.Node, selector string) ([]*html.Node, error) {
+	c, err := Compile(selector)
+	if err != nil {
+		return nil, err
+	}
+	return c.QueryAll(n), nil
+}
+
+func QueryGroup(r *html.Node, g Group) *html.Node {
+	if r == nil {
+		return nil
+	}
+	if r.Type == html.ElementNode && g.Match(r) {
+		return r
+	}
+	for c := r.FirstChild; c != nil; c = c.NextSibling {
+		if n := QueryGroup(c, g); n != nil {
+			return n
+		}
 	}
-	return Query(n, s[0]), nil
+	return nil
+}
+
+func QueryGroupAll(r *html.Node, g Group) []*html.Node {
+	if r == nil {
+		return nil
+	}
+	var result []*html.Node
+	if r.Type == html.ElementNode && g.Match(r) {
+		result = append(result, r)
+	}
+	for c := r.FirstChild; c != nil; c = c.NextSibling {
+		result = append(result, QueryGroupAll(c, g)...)
+	}
+	return result
 }
 
 func QueryNested(r *html.Node, selectors []*Selector) *html.Node {
@@ -90,13 +129,26 @@ func Match(n *html.Node, s *Selector) bool {
 	if n.Type != html.ElementNode {
 		return false
 	}
-	if s.Tag != "" && s.Tag != n.Data {
+	if s.Tag != "" && s.Tag != "*" && s.Tag != n.Data {
 		return false
 	}
 	if s.ID != "" && !hasID(n, s.ID) {
 		return false
 	}
-	return hasClasses(n, s.Classes)
+	if !hasClasses(n, s.Classes) {
+		return false
+	}
+	for _, a := range s.Attrs {
+		if !matchAttr(n, a) {
+			return false
+		}
+	}
+	for _, p := range s.Pseudos {
+		if !matchPseudo(n, p) {
+			return false
+		}
+	}
+	return true
 }
 
 func hasClasses(n *html.Node, classes []string) bool {
@@ -105,9 +157,9 @@ func hasClasses(n *html.Node, classes []string) bool {
 	}
 	for _, a := range n.Attr {
 		if a.Key == "class" {
-			classVal := a.Val
+			tokens := strings.Fields(a.Val)
 			for _, c := range classes {
-				if !strings.Contains(classVal, c) {
+				if !contains(tokens, c) {
 					return false
 				}
 			}
@@ -117,6 +169,15 @@ func hasClasses(n *html.Node, classes []string) bool {
 	return false
 }
 
+func contains(tokens []string, s string) bool {
+	for _, t := range tokens {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
 func hasID(n *html.Node, id string) bool {
 	for _, a := range n.Attr {
 		if a.Key == "id" {
@@ -127,26 +188,24 @@ func hasID(n *html.Node, id string) bool {
 }
 
 func ValidateSelector(s *Selector) error {
-	if s.Tag != "" && !validTag[s.Tag] {
+	if s.Tag != "" && s.Tag != "*" && !validTag[s.Tag] {
 		return fmt.Errorf("%w: %s", ErrInvalidTag, s.Tag)
 	}
-	if s.Tag == "" && s.ID == "" && len(s.Classes) == 0 {
+	if s.Tag == "" && s.ID == "" && len(s.Classes) == 0 && len(s.Attrs) == 0 && len(s.Pseudos) == 0 {
 		return fmt.Errorf("%w: nothing specified: %#v", ErrInvalidSelector, s)
 	}
 	return nil
 }
 
+// Selector is a compound selector, e.g. "td.num[data-sort-value]:last-child".
 type Selector struct {
 	Tag     string
 	ID      string
 	Classes []string
+	Attrs   []Attr
+	Pseudos []Pseudo
 }
 
-const token = "[.#]?-?[_a-zA-Z]+[_a-zA-Z0-9-]*"
-
-var tokenRe = regexp.MustCompile(token)
-var selectorRe = regexp.MustCompile("^(" + token + ")+$")
-
 func ParseSelectors(s string) ([]*Selector, error) {
 	selectors := strings.Fields(s)
 	if len(selectors) == 0 {
@@ -163,29 +222,16 @@ func ParseSelectors(s string) ([]*Selector, error) {
 	return result, nil
 }
 
+// ParseSelector parses a single compound selector without combinators.
 func ParseSelector(s string) (*Selector, error) {
-	if !selectorRe.MatchString(s) {
-		return nil, fmt.Errorf("%w: %s", ErrInvalidSelector, s)
-	}
-	sl := &Selector{}
-	for _, e := range tokenRe.FindAllString(s, -1) {
-		c := e[0]
-		switch {
-		case c == '.':
-			sl.Classes = append(sl.Classes, e[1:])
-		case c == '#' && sl.ID == "":
-			sl.ID = e[1:]
-		case c == '#' && sl.ID != "":
-			return nil, fmt.Errorf("%w: '%s'", ErrDuplicateID, e[1:])
-		case sl.Tag == "":
-			sl.Tag = strings.ToLower(e)
-		default:
-			return nil, fmt.Errorf("%w: bad token %s", ErrInvalidSelector, e)
-		}
-	}
-	if err := ValidateSelector(sl); err != nil {
+	p := &parser{s: s}
+	sl, err := p.parseCompound()
+	if err != nil {
 		return nil, err
 	}
+	if !p.done() {
+		return nil, p.errorf("unexpected character")
+	}
 	return sl, nil
 }
 
@@ -0,0 +1,645 @@
+package htmlx
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var ErrInvalidXPath = fmt.Errorf("invalid xpath")
+
+// XPath is a compiled XPath 1.0 expression evaluated over the html.Node
+// tree, e.g. "//h2[contains(., 'By country')]/following-sibling::table[1]".
+// Variables and namespace prefixes are not supported.
+type XPath struct {
+	source string
+	expr   xexpr
+}
+
+// CompileXPath parses an XPath 1.0 expression. Parse errors are of type
+// *XPathError.
+func CompileXPath(expr string) (*XPath, error) {
+	e, err := parseXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &XPath{source: expr, expr: e}, nil
+}
+
+// MustCompileXPath is like CompileXPath but panics if the expression
+// cannot be parsed.
+func MustCompileXPath(expr string) *XPath {
+	x, err := CompileXPath(expr)
+	if err != nil {
+		panic(err)
+	}
+	return x
+}
+
+// String returns the source text of the expression.
+func (x *XPath) String() string {
+	return x.source
+}
+
+// SelectsNodes reports whether the expression evaluates to a node-set.
+func (x *XPath) SelectsNodes() bool {
+	return x.expr.typ() == xNodeSet
+}
+
+// Evaluate evaluates the expression with n as context node and returns a
+// bool, float64, string or []*html.Node. Attribute nodes are not
+// returned in node-sets; use string(@name) to get attribute values.
+func (x *XPath) Evaluate(n *html.Node) interface{} {
+	v := x.expr.eval(newXContext(n))
+	if ns, ok := v.(nodeSet); ok {
+		return ns.nodes()
+	}
+	return v
+}
+
+// Query returns the first node in document order selected by the
+// expression with n as context node, or nil.
+func (x *XPath) Query(n *html.Node) *html.Node {
+	if nodes := x.QueryAll(n); len(nodes) > 0 {
+		return nodes[0]
+	}
+	return nil
+}
+
+// QueryAll returns the nodes selected by the expression with n as
+// context node in document order.
+func (x *XPath) QueryAll(n *html.Node) []*html.Node {
+	if !x.SelectsNodes() {
+		return nil
+	}
+	return x.expr.eval(newXContext(n)).(nodeSet).nodes()
+}
+
+// XPathError reports where parsing an XPath expression failed.
+type XPathError struct {
+	Expr   string
+	Offset int    // byte offset of Token in Expr
+	Token  string // offending token, empty at end of input
+	Msg    string
+}
+
+func (e *XPathError) Error() string {
+	near := fmt.Sprintf("near %q", e.Token)
+	if e.Token == "" {
+		near = "(end of input)"
+	}
+	return fmt.Sprintf("%v at offset %d %s in %q: %s", ErrInvalidXPath, e.Offset, near, e.Expr, e.Msg)
+}
+
+func (e *XPathError) Unwrap() error {
+	return ErrInvalidXPath
+}
+
+type xtype int
+
+const (
+	xNodeSet xtype = iota
+	xNumber
+	xString
+	xBoolean
+)
+
+// xnode is an html.Node or one of its attributes.
+type xnode struct {
+	n    *html.Node
+	attr int // 1-based index into n.Attr for attribute nodes, 0 otherwise
+}
+
+type nodeSet []xnode
+
+func (ns nodeSet) nodes() []*html.Node {
+	result := []*html.Node{}
+	for _, x := range ns {
+		if x.attr == 0 {
+			result = append(result, x.n)
+		}
+	}
+	return result
+}
+
+type xcontext struct {
+	node      xnode
+	pos, size int
+	order     map[*html.Node]int // document order, shared and built on first use
+}
+
+func newXContext(n *html.Node) *xcontext {
+	return &xcontext{node: xnode{n: n}, pos: 1, size: 1, order: map[*html.Node]int{}}
+}
+
+func (c *xcontext) with(node xnode, pos, size int) *xcontext {
+	return &xcontext{node: node, pos: pos, size: size, order: c.order}
+}
+
+// sort sorts ns in document order and removes duplicates.
+func (c *xcontext) sort(ns nodeSet) nodeSet {
+	if len(ns) < 2 {
+		return ns
+	}
+	if len(c.order) == 0 {
+		for i, n := range append([]*html.Node{root(c.node.n)}, descendantNodes(root(c.node.n))...) {
+			c.order[n] = i
+		}
+	}
+	less := func(a, b xnode) bool {
+		oa, ob := c.order[a.n], c.order[b.n]
+		return oa < ob || (oa == ob && a.attr < b.attr)
+	}
+	sort.SliceStable(ns, func(i, j int) bool { return less(ns[i], ns[j]) })
+	result := ns[:1]
+	for _, x := range ns[1:] {
+		if x != result[len(result)-1] {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+type xexpr interface {
+	eval(c *xcontext) interface{} // bool, float64, string or nodeSet
+	typ() xtype
+}
+
+type literalExpr string
+
+func (e literalExpr) eval(*xcontext) interface{} { return string(e) }
+func (e literalExpr) typ() xtype                 { return xString }
+
+type numberExpr float64
+
+func (e numberExpr) eval(*xcontext) interface{} { return float64(e) }
+func (e numberExpr) typ() xtype                 { return xNumber }
+
+type negExpr struct {
+	e xexpr
+}
+
+func (e *negExpr) eval(c *xcontext) interface{} { return -toNumber(e.e.eval(c)) }
+func (e *negExpr) typ() xtype                   { return xNumber }
+
+type binaryExpr struct {
+	op   string
+	l, r xexpr
+}
+
+func (e *binaryExpr) typ() xtype {
+	switch e.op {
+	case "+", "-", "*", "div", "mod":
+		return xNumber
+	}
+	return xBoolean
+}
+
+func (e *binaryExpr) eval(c *xcontext) interface{} {
+	switch e.op {
+	case "or":
+		return toBool(e.l.eval(c)) || toBool(e.r.eval(c))
+	case "and":
+		return toBool(e.l.eval(c)) && toBool(e.r.eval(c))
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compare(e.op, e.l.eval(c), e.r.eval(c))
+	}
+	l, r := toNumber(e.l.eval(c)), toNumber(e.r.eval(c))
+	switch e.op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "div":
+		return l / r
+	default:
+		return math.Mod(l, r)
+	}
+}
+
+type unionExpr struct {
+	l, r xexpr
+}
+
+func (e *unionExpr) eval(c *xcontext) interface{} {
+	ns := append(nodeSet{}, e.l.eval(c).(nodeSet)...)
+	return c.sort(append(ns, e.r.eval(c).(nodeSet)...))
+}
+
+func (e *unionExpr) typ() xtype { return xNodeSet }
+
+type filterExpr struct {
+	e     xexpr
+	preds []xexpr
+}
+
+func (e *filterExpr) eval(c *xcontext) interface{} {
+	ns := e.e.eval(c).(nodeSet)
+	for _, pred := range e.preds {
+		ns = filter(c, ns, pred)
+	}
+	return ns
+}
+
+func (e *filterExpr) typ() xtype { return xNodeSet }
+
+type pathExpr struct {
+	base     xexpr // filter expression the path starts from, if any
+	absolute bool
+	steps    []*xstep
+}
+
+func (e *pathExpr) typ() xtype { return xNodeSet }
+
+func (e *pathExpr) eval(c *xcontext) interface{} {
+	var ns nodeSet
+	switch {
+	case e.base != nil:
+		ns = e.base.eval(c).(nodeSet)
+	case e.absolute:
+		ns = nodeSet{{n: root(c.node.n)}}
+	default:
+		ns = nodeSet{c.node}
+	}
+	for _, step := range e.steps {
+		var next nodeSet
+		for _, x := range ns {
+			next = append(next, step.eval(c, x)...)
+		}
+		ns = c.sort(next)
+	}
+	return ns
+}
+
+type xaxis int
+
+const (
+	axisAncestor xaxis = iota
+	axisAncestorOrSelf
+	axisAttribute
+	axisChild
+	axisDescendant
+	axisDescendantOrSelf
+	axisFollowing
+	axisFollowingSibling
+	axisParent
+	axisPreceding
+	axisPrecedingSibling
+	axisSelf
+)
+
+// xnodeTest matches nodes by name, "*" for any name, or by node type
+// ("node", "text", "comment" or "processing-instruction").
+type xnodeTest struct {
+	name string
+	typ  string
+}
+
+type xstep struct {
+	axis  xaxis
+	test  xnodeTest
+	preds []xexpr
+}
+
+// eval returns the nodes matching the step from x in axis order.
+func (s *xstep) eval(c *xcontext, x xnode) nodeSet {
+	var ns nodeSet
+	for _, y := range s.axisNodes(x) {
+		if s.match(y) {
+			ns = append(ns, y)
+		}
+	}
+	for _, pred := range s.preds {
+		ns = filter(c, ns, pred)
+	}
+	return ns
+}
+
+func (s *xstep) match(x xnode) bool {
+	switch s.test.typ {
+	case "node":
+		return true
+	case "text":
+		return x.attr == 0 && x.n.Type == html.TextNode
+	case "comment":
+		return x.attr == 0 && x.n.Type == html.CommentNode
+	case "processing-instruction":
+		return false
+	}
+	if s.axis == axisAttribute {
+		return x.attr != 0 && (s.test.name == "*" || strings.EqualFold(s.test.name, x.n.Attr[x.attr-1].Key))
+	}
+	return x.attr == 0 && x.n.Type == html.ElementNode && (s.test.name == "*" || strings.EqualFold(s.test.name, x.n.Data))
+}
+
+func (s *xstep) axisNodes(x xnode) nodeSet {
+	var nodes []*html.Node
+	n := x.n
+	switch s.axis {
+	case axisSelf:
+		return nodeSet{x}
+	case axisAttribute:
+		var ns nodeSet
+		if x.attr == 0 && n.Type == html.ElementNode {
+			for i := range n.Attr {
+				ns = append(ns, xnode{n: n, attr: i + 1})
+			}
+		}
+		return ns
+	case axisParent:
+		if x.attr != 0 {
+			return nodeSet{{n: n}}
+		}
+		if n.Parent != nil {
+			nodes = []*html.Node{n.Parent}
+		}
+	case axisAncestor, axisAncestorOrSelf:
+		var ns nodeSet
+		if s.axis == axisAncestorOrSelf {
+			ns = append(ns, x)
+		}
+		if x.attr != 0 {
+			ns = append(ns, xnode{n: n})
+		}
+		for p := n.Parent; p != nil; p = p.Parent {
+			ns = append(ns, xnode{n: p})
+		}
+		return ns
+	case axisChild:
+		if x.attr == 0 {
+			nodes = childNodes(n)
+		}
+	case axisDescendant, axisDescendantOrSelf:
+		var ns nodeSet
+		if s.axis == axisDescendantOrSelf {
+			ns = append(ns, x)
+		}
+		if x.attr == 0 {
+			for _, d := range descendantNodes(n) {
+				if isXPathNode(d) {
+					ns = append(ns, xnode{n: d})
+				}
+			}
+		}
+		return ns
+	case axisFollowingSibling:
+		if x.attr == 0 {
+			for sib := n.NextSibling; sib != nil; sib = sib.NextSibling {
+				nodes = append(nodes, sib)
+			}
+		}
+	case axisPrecedingSibling:
+		if x.attr == 0 {
+			for sib := n.PrevSibling; sib != nil; sib = sib.PrevSibling {
+				nodes = append(nodes, sib)
+			}
+		}
+	case axisFollowing:
+		if x.attr != 0 {
+			nodes = descendantNodes(n)
+		}
+		for a := n; a != nil; a = a.Parent {
+			for sib := a.NextSibling; sib != nil; sib = sib.NextSibling {
+				nodes = append(nodes, sib)
+				nodes = append(nodes, descendantNodes(sib)...)
+			}
+		}
+	case axisPreceding:
+		for a := n; a != nil; a = a.Parent {
+			for sib := a.PrevSibling; sib != nil; sib = sib.PrevSibling {
+				d := descendantNodes(sib)
+				for i := len(d) - 1; i >= 0; i-- {
+					nodes = append(nodes, d[i])
+				}
+				nodes = append(nodes, sib)
+			}
+		}
+	}
+	ns := make(nodeSet, 0, len(nodes))
+	for _, n := range nodes {
+		if isXPathNode(n) {
+			ns = append(ns, xnode{n: n})
+		}
+	}
+	return ns
+}
+
+// filter returns the nodes of ns for which pred is true, with positions
+// taken in the order of ns.
+func filter(c *xcontext, ns nodeSet, pred xexpr) nodeSet {
+	var result nodeSet
+	for i, x := range ns {
+		v := pred.eval(c.with(x, i+1, len(ns)))
+		if f, ok := v.(float64); ok {
+			if f == float64(i+1) {
+				result = append(result, x)
+			}
+		} else if toBool(v) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// compare compares two values as described in XPath 1.0 section 3.4,
+// where node-sets compare true if any of their nodes does.
+func compare(op string, a, b interface{}) bool {
+	nsA, okA := a.(nodeSet)
+	nsB, okB := b.(nodeSet)
+	switch {
+	case okA && okB:
+		for _, x := range nsA {
+			for _, y := range nsB {
+				if compareAtoms(op, stringValue(x), stringValue(y)) {
+					return true
+				}
+			}
+		}
+		return false
+	case okB:
+		return compare(reverseOp(op), b, a)
+	case okA:
+		switch b.(type) {
+		case bool:
+			return compareAtoms(op, toBool(a), b)
+		case float64:
+			for _, x := range nsA {
+				if compareAtoms(op, toNumber(stringValue(x)), b) {
+					return true
+				}
+			}
+		default:
+			for _, x := range nsA {
+				if compareAtoms(op, stringValue(x), b) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return compareAtoms(op, a, b)
+}
+
+func reverseOp(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+func compareAtoms(op string, a, b interface{}) bool {
+	if op == "=" || op == "!=" {
+		var eq bool
+		_, boolA := a.(bool)
+		_, boolB := b.(bool)
+		_, numA := a.(float64)
+		_, numB := b.(float64)
+		switch {
+		case boolA || boolB:
+			eq = toBool(a) == toBool(b)
+		case numA || numB:
+			eq = toNumber(a) == toNumber(b)
+		default:
+			eq = toString(a) == toString(b)
+		}
+		return eq == (op == "=")
+	}
+	l, r := toNumber(a), toNumber(b)
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	}
+	return l >= r
+}
+
+func toBool(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	case nodeSet:
+		return len(v) > 0
+	}
+	return false
+}
+
+func toNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		return v
+	case nodeSet:
+		return toNumber(toString(v))
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" || strings.ContainsAny(s, "eExXpP_+") || strings.EqualFold(s, "nan") || strings.Contains(strings.ToLower(s), "inf") {
+			return math.NaN()
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return math.NaN()
+		}
+		return f
+	}
+	return math.NaN()
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		case v == 0:
+			return "0"
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case nodeSet:
+		if len(v) == 0 {
+			return ""
+		}
+		return stringValue(v[0])
+	}
+	return ""
+}
+
+func stringValue(x xnode) string {
+	if x.attr != 0 {
+		return x.n.Attr[x.attr-1].Val
+	}
+	switch x.n.Type {
+	case html.TextNode, html.CommentNode:
+		return x.n.Data
+	}
+	var sb strings.Builder
+	for _, d := range descendantNodes(x.n) {
+		if d.Type == html.TextNode {
+			sb.WriteString(d.Data)
+		}
+	}
+	return sb.String()
+}
+
+// isXPathNode reports whether n is part of the XPath data model, which
+// has no doctype nodes.
+func isXPathNode(n *html.Node) bool {
+	return n.Type != html.DoctypeNode && n.Type != html.ErrorNode
+}
+
+func childNodes(n *html.Node) []*html.Node {
+	var result []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		result = append(result, c)
+	}
+	return result
+}
+
+// descendantNodes returns all descendants of n in document order,
+// including text and comment nodes.
+func descendantNodes(n *html.Node) []*html.Node {
+	var result []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		result = append(result, c)
+		result = append(result, descendantNodes(c)...)
+	}
+	return result
+}
+
+func root(n *html.Node) *html.Node {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	return n
+}
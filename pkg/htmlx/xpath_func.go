@@ -0,0 +1,230 @@
+package htmlx
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+type xfunc struct {
+	minArgs, maxArgs int // maxArgs -1 for variadic
+	ret              xtype
+	nodeSetArgs      bool // all arguments must be node-sets
+	fn               func(c *xcontext, args []interface{}) interface{}
+}
+
+type funcExpr struct {
+	fn   *xfunc
+	args []xexpr
+}
+
+func (e *funcExpr) eval(c *xcontext) interface{} {
+	args := make([]interface{}, len(e.args))
+	for i, arg := range e.args {
+		args[i] = arg.eval(c)
+	}
+	return e.fn.fn(c, args)
+}
+
+func (e *funcExpr) typ() xtype { return e.fn.ret }
+
+// xfuncs is the XPath 1.0 core function library, without namespace and
+// processing instruction support.
+var xfuncs = map[string]*xfunc{
+	"last":             {ret: xNumber, fn: func(c *xcontext, _ []interface{}) interface{} { return float64(c.size) }},
+	"position":         {ret: xNumber, fn: func(c *xcontext, _ []interface{}) interface{} { return float64(c.pos) }},
+	"count":            {minArgs: 1, maxArgs: 1, ret: xNumber, nodeSetArgs: true, fn: xcount},
+	"id":               {minArgs: 1, maxArgs: 1, ret: xNodeSet, fn: xid},
+	"local-name":       {maxArgs: 1, ret: xString, nodeSetArgs: true, fn: xname},
+	"name":             {maxArgs: 1, ret: xString, nodeSetArgs: true, fn: xname},
+	"namespace-uri":    {maxArgs: 1, ret: xString, nodeSetArgs: true, fn: func(*xcontext, []interface{}) interface{} { return "" }},
+	"string":           {maxArgs: 1, ret: xString, fn: xstring},
+	"concat":           {minArgs: 2, maxArgs: -1, ret: xString, fn: xconcat},
+	"starts-with":      {minArgs: 2, maxArgs: 2, ret: xBoolean, fn: xstartsWith},
+	"contains":         {minArgs: 2, maxArgs: 2, ret: xBoolean, fn: xcontains},
+	"substring-before": {minArgs: 2, maxArgs: 2, ret: xString, fn: xsubstringBefore},
+	"substring-after":  {minArgs: 2, maxArgs: 2, ret: xString, fn: xsubstringAfter},
+	"substring":        {minArgs: 2, maxArgs: 3, ret: xString, fn: xsubstring},
+	"string-length":    {maxArgs: 1, ret: xNumber, fn: xstringLength},
+	"normalize-space":  {maxArgs: 1, ret: xString, fn: xnormalizeSpace},
+	"translate":        {minArgs: 3, maxArgs: 3, ret: xString, fn: xtranslate},
+	"boolean":          {minArgs: 1, maxArgs: 1, ret: xBoolean, fn: func(_ *xcontext, args []interface{}) interface{} { return toBool(args[0]) }},
+	"not":              {minArgs: 1, maxArgs: 1, ret: xBoolean, fn: func(_ *xcontext, args []interface{}) interface{} { return !toBool(args[0]) }},
+	"true":             {ret: xBoolean, fn: func(*xcontext, []interface{}) interface{} { return true }},
+	"false":            {ret: xBoolean, fn: func(*xcontext, []interface{}) interface{} { return false }},
+	"lang":             {minArgs: 1, maxArgs: 1, ret: xBoolean, fn: xlang},
+	"number":           {maxArgs: 1, ret: xNumber, fn: xnumber},
+	"sum":              {minArgs: 1, maxArgs: 1, ret: xNumber, nodeSetArgs: true, fn: xsum},
+	"floor":            {minArgs: 1, maxArgs: 1, ret: xNumber, fn: func(_ *xcontext, args []interface{}) interface{} { return math.Floor(toNumber(args[0])) }},
+	"ceiling":          {minArgs: 1, maxArgs: 1, ret: xNumber, fn: func(_ *xcontext, args []interface{}) interface{} { return math.Ceil(toNumber(args[0])) }},
+	"round":            {minArgs: 1, maxArgs: 1, ret: xNumber, fn: func(_ *xcontext, args []interface{}) interface{} { return xround(toNumber(args[0])) }},
+}
+
+// argString returns the string value of the first argument or of the
+// context node if there is none.
+func argString(c *xcontext, args []interface{}) string {
+	if len(args) == 0 {
+		return stringValue(c.node)
+	}
+	return toString(args[0])
+}
+
+func xcount(_ *xcontext, args []interface{}) interface{} {
+	return float64(len(args[0].(nodeSet)))
+}
+
+func xid(c *xcontext, args []interface{}) interface{} {
+	var ids []string
+	if ns, ok := args[0].(nodeSet); ok {
+		for _, x := range ns {
+			ids = append(ids, strings.Fields(stringValue(x))...)
+		}
+	} else {
+		ids = strings.Fields(toString(args[0]))
+	}
+	var result nodeSet
+	for _, n := range descendantNodes(root(c.node.n)) {
+		if n.Type == html.ElementNode {
+			for _, id := range ids {
+				if hasID(n, id) {
+					result = append(result, xnode{n: n})
+					break
+				}
+			}
+		}
+	}
+	return result
+}
+
+func xname(c *xcontext, args []interface{}) interface{} {
+	x := c.node
+	if len(args) > 0 {
+		ns := args[0].(nodeSet)
+		if len(ns) == 0 {
+			return ""
+		}
+		x = ns[0]
+	}
+	if x.attr != 0 {
+		return x.n.Attr[x.attr-1].Key
+	}
+	if x.n.Type == html.ElementNode {
+		return x.n.Data
+	}
+	return ""
+}
+
+func xstring(c *xcontext, args []interface{}) interface{} {
+	return argString(c, args)
+}
+
+func xconcat(_ *xcontext, args []interface{}) interface{} {
+	var sb strings.Builder
+	for _, arg := range args {
+		sb.WriteString(toString(arg))
+	}
+	return sb.String()
+}
+
+func xstartsWith(_ *xcontext, args []interface{}) interface{} {
+	return strings.HasPrefix(toString(args[0]), toString(args[1]))
+}
+
+func xcontains(_ *xcontext, args []interface{}) interface{} {
+	return strings.Contains(toString(args[0]), toString(args[1]))
+}
+
+func xsubstringBefore(_ *xcontext, args []interface{}) interface{} {
+	s, sep := toString(args[0]), toString(args[1])
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i]
+	}
+	return ""
+}
+
+func xsubstringAfter(_ *xcontext, args []interface{}) interface{} {
+	s, sep := toString(args[0]), toString(args[1])
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[i+len(sep):]
+	}
+	return ""
+}
+
+// xsubstring returns the characters at 1-based positions p with
+// round(start) <= p < round(start) + round(length).
+func xsubstring(_ *xcontext, args []interface{}) interface{} {
+	runes := []rune(toString(args[0]))
+	start := xround(toNumber(args[1]))
+	end := math.Inf(1)
+	if len(args) == 3 {
+		end = start + xround(toNumber(args[2]))
+	}
+	var sb strings.Builder
+	for i, r := range runes {
+		if p := float64(i + 1); p >= start && p < end {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+func xstringLength(c *xcontext, args []interface{}) interface{} {
+	return float64(utf8.RuneCountInString(argString(c, args)))
+}
+
+func xnormalizeSpace(c *xcontext, args []interface{}) interface{} {
+	return strings.Join(strings.Fields(argString(c, args)), " ")
+}
+
+func xtranslate(_ *xcontext, args []interface{}) interface{} {
+	from, to := []rune(toString(args[1])), []rune(toString(args[2]))
+	return strings.Map(func(r rune) rune {
+		for i, f := range from {
+			if f == r {
+				if i < len(to) {
+					return to[i]
+				}
+				return -1
+			}
+		}
+		return r
+	}, toString(args[0]))
+}
+
+func xlang(c *xcontext, args []interface{}) interface{} {
+	want := strings.ToLower(toString(args[0]))
+	for n := c.node.n; n != nil; n = n.Parent {
+		for _, a := range n.Attr {
+			if a.Key == "lang" || a.Key == "xml:lang" {
+				lang := strings.ToLower(a.Val)
+				return lang == want || strings.HasPrefix(lang, want+"-")
+			}
+		}
+	}
+	return false
+}
+
+func xnumber(c *xcontext, args []interface{}) interface{} {
+	if len(args) == 0 {
+		return toNumber(stringValue(c.node))
+	}
+	return toNumber(args[0])
+}
+
+func xsum(_ *xcontext, args []interface{}) interface{} {
+	var sum float64
+	for _, x := range args[0].(nodeSet) {
+		sum += toNumber(stringValue(x))
+	}
+	return sum
+}
+
+// xround rounds half up as XPath's round() does.
+func xround(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+	return math.Floor(f + 0.5)
+}
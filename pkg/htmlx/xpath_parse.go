@@ -0,0 +1,479 @@
+package htmlx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type xtokenKind int
+
+const (
+	tokEOF     xtokenKind = iota
+	tokName               // NCName, QName or "*" name test
+	tokOp                 // operator or punctuation, e.g. "//", "::", "and" or "*" multiply
+	tokLiteral            // quoted string, val is unquoted
+	tokNumber
+)
+
+type xtoken struct {
+	kind     xtokenKind
+	val      string
+	pos, end int
+}
+
+// xoperators are the tokens after which "*" is a name test and an NCName
+// is a name rather than an operator name, see XPath 1.0 section 3.7.
+var xoperators = map[string]bool{
+	"@": true, "::": true, "(": true, "[": true, ",": true,
+	"and": true, "or": true, "mod": true, "div": true, "*": true,
+	"/": true, "//": true, "|": true, "+": true, "-": true,
+	"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+}
+
+type xlexer struct {
+	s    string
+	pos  int
+	toks []xtoken
+}
+
+func lexXPath(s string) ([]xtoken, error) {
+	l := &xlexer{s: s}
+	for {
+		for l.pos < len(s) && isSpace(s[l.pos]) {
+			l.pos++
+		}
+		if l.pos >= len(s) {
+			l.toks = append(l.toks, xtoken{kind: tokEOF, pos: len(s), end: len(s)})
+			return l.toks, nil
+		}
+		if err := l.next(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// operand reports whether the previous token ends an operand, which makes
+// "*" a multiplication and an NCName an operator name.
+func (l *xlexer) operand() bool {
+	if len(l.toks) == 0 {
+		return false
+	}
+	prev := l.toks[len(l.toks)-1]
+	return prev.kind != tokOp || !xoperators[prev.val]
+}
+
+func (l *xlexer) emit(kind xtokenKind, val string, start int) {
+	l.toks = append(l.toks, xtoken{kind: kind, val: val, pos: start, end: l.pos})
+}
+
+// errorf reports an error for the token from start to the current
+// position, or the character at start if nothing has been consumed.
+func (l *xlexer) errorf(start int, format string, args ...interface{}) error {
+	end := l.pos
+	if end <= start {
+		end = start + 1
+	}
+	return &XPathError{Expr: l.s, Offset: start, Token: l.s[start:end], Msg: fmt.Sprintf(format, args...)}
+}
+
+func (l *xlexer) next() error {
+	s, start := l.s, l.pos
+	c := s[start]
+	switch {
+	case c == '"' || c == '\'':
+		end := strings.IndexByte(s[start+1:], c)
+		if end == -1 {
+			return l.errorf(start, "unterminated string")
+		}
+		l.pos = start + 1 + end + 1
+		l.emit(tokLiteral, s[start+1:start+1+end], start)
+	case isDigit(c) || (c == '.' && start+1 < len(s) && isDigit(s[start+1])):
+		for l.pos < len(s) && isDigit(s[l.pos]) {
+			l.pos++
+		}
+		if l.pos < len(s) && s[l.pos] == '.' {
+			l.pos++
+			for l.pos < len(s) && isDigit(s[l.pos]) {
+				l.pos++
+			}
+		}
+		l.emit(tokNumber, s[start:l.pos], start)
+	case c == '*':
+		l.pos++
+		if l.operand() {
+			l.emit(tokOp, "*", start)
+		} else {
+			l.emit(tokName, "*", start)
+		}
+	case isIdentStart(c):
+		for l.pos < len(s) && (isIdentChar(s[l.pos]) || s[l.pos] == '.') {
+			l.pos++
+		}
+		if l.pos+1 < len(s) && s[l.pos] == ':' && s[l.pos+1] != ':' {
+			l.pos++
+			if s[l.pos] == '*' {
+				l.pos++
+			} else {
+				for l.pos < len(s) && (isIdentChar(s[l.pos]) || s[l.pos] == '.') {
+					l.pos++
+				}
+			}
+		}
+		name := s[start:l.pos]
+		if !l.operand() {
+			l.emit(tokName, name, start)
+			return nil
+		}
+		switch name {
+		case "and", "or", "mod", "div":
+			l.emit(tokOp, name, start)
+			return nil
+		}
+		return l.errorf(start, "expected operator")
+	case c == '$':
+		return l.errorf(start, "variables not supported")
+	default:
+		for _, op := range []string{"//", "::", "..", "!=", "<=", ">=", "/", ".", "<", ">", "(", ")", "[", "]", "@", ",", "|", "+", "-", "="} {
+			if strings.HasPrefix(s[start:], op) {
+				l.pos += len(op)
+				l.emit(tokOp, op, start)
+				return nil
+			}
+		}
+		return l.errorf(start, "unexpected character")
+	}
+	return nil
+}
+
+var xaxes = map[string]xaxis{
+	"ancestor":           axisAncestor,
+	"ancestor-or-self":   axisAncestorOrSelf,
+	"attribute":          axisAttribute,
+	"child":              axisChild,
+	"descendant":         axisDescendant,
+	"descendant-or-self": axisDescendantOrSelf,
+	"following":          axisFollowing,
+	"following-sibling":  axisFollowingSibling,
+	"parent":             axisParent,
+	"preceding":          axisPreceding,
+	"preceding-sibling":  axisPrecedingSibling,
+	"self":               axisSelf,
+}
+
+var xnodeTypes = map[string]bool{"node": true, "text": true, "comment": true, "processing-instruction": true}
+
+var xbinaryLevels = [][]string{
+	{"or"},
+	{"and"},
+	{"=", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "div", "mod"},
+}
+
+type xparser struct {
+	s    string
+	toks []xtoken
+	i    int
+}
+
+func (p *xparser) peek() xtoken {
+	return p.toks[p.i]
+}
+
+func (p *xparser) peekN(n int) xtoken {
+	if p.i+n >= len(p.toks) {
+		return p.toks[len(p.toks)-1]
+	}
+	return p.toks[p.i+n]
+}
+
+func (p *xparser) next() xtoken {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *xparser) isOp(val string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.val == val
+}
+
+func (p *xparser) expect(val string) error {
+	if !p.isOp(val) {
+		return p.errorf(p.peek(), "expected '%s'", val)
+	}
+	p.next()
+	return nil
+}
+
+func (p *xparser) errorf(t xtoken, format string, args ...interface{}) error {
+	return &XPathError{Expr: p.s, Offset: t.pos, Token: p.s[t.pos:t.end], Msg: fmt.Sprintf(format, args...)}
+}
+
+func parseXPath(s string) (xexpr, error) {
+	toks, err := lexXPath(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &xparser{s: s, toks: toks}
+	e, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected token")
+	}
+	return e, nil
+}
+
+func (p *xparser) parseBinary(level int) (xexpr, error) {
+	if level == len(xbinaryLevels) {
+		return p.parseUnary()
+	}
+	l, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || !contains(xbinaryLevels[level], t.val) {
+			return l, nil
+		}
+		p.next()
+		r, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: t.val, l: l, r: r}
+	}
+}
+
+func (p *xparser) parseUnary() (xexpr, error) {
+	if p.isOp("-") {
+		p.next()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negExpr{e: e}, nil
+	}
+	l, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("|") {
+		t := p.next()
+		r, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if l.typ() != xNodeSet || r.typ() != xNodeSet {
+			return nil, p.errorf(t, "union of non node-sets")
+		}
+		l = &unionExpr{l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *xparser) parsePath() (xexpr, error) {
+	t := p.peek()
+	isFunc := t.kind == tokName && p.peekN(1).kind == tokOp && p.peekN(1).val == "(" && !xnodeTypes[t.val]
+	if t.kind != tokLiteral && t.kind != tokNumber && !isFunc && !p.isOp("(") {
+		return p.parseLocationPath()
+	}
+	f, err := p.parseFilter()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("/") && !p.isOp("//") {
+		return f, nil
+	}
+	if f.typ() != xNodeSet {
+		return nil, p.errorf(p.peek(), "path from non node-set")
+	}
+	path := &pathExpr{base: f}
+	return path, p.parseRelative(path)
+}
+
+func (p *xparser) parseFilter() (xexpr, error) {
+	start := p.peek()
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("[") {
+		return e, nil
+	}
+	if e.typ() != xNodeSet {
+		return nil, p.errorf(start, "predicate on non node-set")
+	}
+	f := &filterExpr{e: e}
+	f.preds, err = p.parsePredicates()
+	return f, err
+}
+
+func (p *xparser) parsePrimary() (xexpr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLiteral:
+		return literalExpr(t.val), nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number")
+		}
+		return numberExpr(f), nil
+	case tokName:
+		return p.parseFunc(t)
+	}
+	if t.kind == tokOp && t.val == "(" {
+		e, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	}
+	return nil, p.errorf(t, "expected expression")
+}
+
+func (p *xparser) parseFunc(name xtoken) (xexpr, error) {
+	fn, ok := xfuncs[name.val]
+	if !ok {
+		return nil, p.errorf(name, "unknown function")
+	}
+	p.next() // "("
+	call := &funcExpr{fn: fn}
+	for !p.isOp(")") {
+		if len(call.args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		start := p.peek()
+		arg, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if fn.nodeSetArgs && arg.typ() != xNodeSet {
+			return nil, p.errorf(start, "%s() expects a node-set", name.val)
+		}
+		call.args = append(call.args, arg)
+	}
+	p.next()
+	if len(call.args) < fn.minArgs || (fn.maxArgs >= 0 && len(call.args) > fn.maxArgs) {
+		return nil, p.errorf(name, "wrong number of arguments for %s()", name.val)
+	}
+	return call, nil
+}
+
+func (p *xparser) parsePredicates() ([]xexpr, error) {
+	var preds []xexpr
+	for p.isOp("[") {
+		p.next()
+		e, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		preds = append(preds, e)
+	}
+	return preds, nil
+}
+
+func (p *xparser) parseLocationPath() (xexpr, error) {
+	path := &pathExpr{}
+	switch {
+	case p.isOp("/"):
+		p.next()
+		path.absolute = true
+		if !p.startsStep() {
+			return path, nil
+		}
+	case p.isOp("//"):
+		p.next()
+		path.absolute = true
+		path.steps = append(path.steps, &xstep{axis: axisDescendantOrSelf, test: xnodeTest{typ: "node"}})
+	}
+	step, err := p.parseStep()
+	if err != nil {
+		return nil, err
+	}
+	path.steps = append(path.steps, step)
+	return path, p.parseRelative(path)
+}
+
+func (p *xparser) startsStep() bool {
+	t := p.peek()
+	return t.kind == tokName || p.isOp(".") || p.isOp("..") || p.isOp("@")
+}
+
+// parseRelative appends "/step" and "//step" sequences to path.
+func (p *xparser) parseRelative(path *pathExpr) error {
+	for p.isOp("/") || p.isOp("//") {
+		if p.next().val == "//" {
+			path.steps = append(path.steps, &xstep{axis: axisDescendantOrSelf, test: xnodeTest{typ: "node"}})
+		}
+		step, err := p.parseStep()
+		if err != nil {
+			return err
+		}
+		path.steps = append(path.steps, step)
+	}
+	return nil
+}
+
+func (p *xparser) parseStep() (*xstep, error) {
+	switch {
+	case p.isOp("."):
+		p.next()
+		return &xstep{axis: axisSelf, test: xnodeTest{typ: "node"}}, nil
+	case p.isOp(".."):
+		p.next()
+		return &xstep{axis: axisParent, test: xnodeTest{typ: "node"}}, nil
+	}
+	step := &xstep{axis: axisChild}
+	if p.isOp("@") {
+		p.next()
+		step.axis = axisAttribute
+	} else if t := p.peek(); t.kind == tokName && p.peekN(1).kind == tokOp && p.peekN(1).val == "::" {
+		axis, ok := xaxes[t.val]
+		if !ok {
+			return nil, p.errorf(t, "unsupported axis")
+		}
+		step.axis = axis
+		p.next()
+		p.next()
+	}
+	t := p.next()
+	if t.kind != tokName {
+		return nil, p.errorf(t, "expected node test")
+	}
+	switch {
+	case xnodeTypes[t.val] && p.isOp("("):
+		p.next()
+		if t.val == "processing-instruction" && p.peek().kind == tokLiteral {
+			p.next()
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		step.test = xnodeTest{typ: t.val}
+	case strings.Contains(t.val, ":"):
+		return nil, p.errorf(t, "namespace prefixes not supported")
+	default:
+		step.test = xnodeTest{name: t.val}
+	}
+	var err error
+	step.preds, err = p.parsePredicates()
+	return step, err
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
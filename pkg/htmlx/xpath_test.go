@@ -0,0 +1,184 @@
+package htmlx
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestXPathQueryAll(t *testing.T) {
+	doc := parseTestDoc(t)
+	tests := map[string][]string{
+		"/html":                   {"doc"},
+		"/html/body/div":          {"main", "other"},
+		"//table":                 {"t1", "t2"},
+		"//div[@id='main']/table": {"t1"},
+		"//h2[contains(., 'By country')]/following-sibling::table[1]": {"t1"},
+		"//h2/following-sibling::*[2]":                                {"t1"},
+		"//h2/following-sibling::p[last()]":                           {"p2"},
+		"//p[2]/preceding-sibling::*[1]":                              {"t1"},
+		"//p[last()]/preceding-sibling::p":                            {"p1"},
+		"//tr[td[not(node())]]":                                       {"r2"},
+		"//tr[position() mod 2 = 1]":                                  {"r1", "r3", "r4"},
+		"//tr[position() > 1 and position() <= 3]":                    {"r2", "r3"},
+		"(//tr)[last()]":                                              {"r4"},
+		"(//td | //th)[3]":                                            {"c3"},
+		"//th | //p":                                                  {"p1", "c1", "c3", "c5", "p2"},
+		"//a/ancestor::tr":                                            {"r3"},
+		"//a/ancestor::*[2]":                                          {"r3"},
+		"//a/ancestor-or-self::*[@id][1]":                             {"a1"},
+		"//td[@data-sort-value > 5]":                                  {"c2"},
+		"//td[@data-sort-value = '7']/..":                             {"r1"},
+		"//*[@class='legend']":                                        {"t2"},
+		"//*[contains(concat(' ', @class, ' '), ' sortable ')]":       {"t1"},
+		"//table[count(tbody/tr) = 3]":                                {"t1"},
+		"//span/preceding::th[1]":                                     {"c5"},
+		"//h2/following::td[last()]":                                  {"c7"},
+		"//th[. = 'Italy']/following-sibling::td":                     {"c4"},
+		"//th[normalize-space() = 'Spain']":                           {"c5"},
+		"//a[starts-with(@href, '/wiki/')]":                           {"a1"},
+		"//a[lang('en')]":                                             {"a1"},
+		"//td[lang('en')]":                                            nil,
+		"id('p1 p2')":                                                 {"p1", "p2"},
+		"id('t1')/tbody/tr[2]/th":                                     {"c3"},
+		"//tr/@id/..":                                                 {"r1", "r2", "r3", "r4"},
+		"//table[@*]":                                                 {"t1", "t2"},
+		"//div[1]//tr[1]/*[last()]":                                   {"c2"},
+		"//body/*[self::p or self::span]":                             nil,
+		"//div/*[self::p or self::span]":                              {"p1", "p2", "s1"},
+		"//div/child::node()[self::h2]":                               {"h-cases"},
+		"//td[@id = 'c6']/descendant-or-self::*":                      {"c6", "a1"},
+		"//td[string-length(@id) = 2][. = '7' or . = 'x']":            {"c2", "c7"},
+		"//td[sum(../th/@missing) = 0][1]":                            {"c2", "c4", "c6", "c7"},
+		"//tr[th='Italy']/following-sibling::tr/td":                   {"c6"},
+		"//p[1]":            {"p1"},
+		"//p[position()=1]": {"p1"},
+		"/descendant::p[1]": {"p1"},
+	}
+	for expr, want := range tests {
+		expr, want := expr, want
+		t.Run(expr, func(t *testing.T) {
+			x, err := CompileXPath(expr)
+			require.NoError(t, err)
+			require.True(t, x.SelectsNodes())
+			got := ids(x.QueryAll(doc))
+			if want == nil {
+				want = []string{}
+			}
+			require.Equal(t, want, got)
+		})
+	}
+}
+
+func TestXPathEvaluate(t *testing.T) {
+	doc := parseTestDoc(t)
+	tests := map[string]interface{}{
+		"count(//tr)":                             4.0,
+		"sum(//td/@data-sort-value) + 1":          8.0,
+		"string(//a/@href)":                       "/wiki/Spain",
+		"name(//*[@id='t2'])":                     "table",
+		"local-name(//a/@lang)":                   "lang",
+		"normalize-space(//h2)":                   "By country",
+		"concat('a', 1, true())":                  "a1true",
+		"substring('12345', 1.5, 2.6)":            "234",
+		"substring('12345', 0, 3)":                "12",
+		"substring('12345', 2)":                   "2345",
+		"substring-before('1999/04/01', '/')":     "1999",
+		"substring-after('1999/04/01', '/')":      "04/01",
+		"translate('bar', 'abc', 'ABC')":          "BAr",
+		"translate('--aaa--', 'abc-', 'ABC')":     "AAA",
+		"string-length('Spaß')":                   4.0,
+		"7 div 2":                                 3.5,
+		"7 mod -2":                                1.0,
+		"-(2 * 3) - -1":                           -5.0,
+		"round(2.5) + floor(-1.5) + ceiling(0.2)": 2.0,
+		"number('  12.5 ')":                       12.5,
+		"string(1 div 0)":                         "Infinity",
+		"string(0 div 0)":                         "NaN",
+		"string(-0)":                              "0",
+		"string(12.50)":                           "12.5",
+		"1 < 2 = true()":                          true,
+		"//td = '7'":                              true,
+		"//td != '7'":                             true,
+		"//td = //th":                             true,
+		"//td = 'Country'":                        false,
+		"//tr = //tr":                             true,
+		"'7' = //td":                              true,
+		"7 > //td":                                false,
+		"//td/@data-sort-value >= 7":              true,
+		"not(//ul)":                               true,
+		"boolean('')":                             false,
+		"//h2 and 0":                              false,
+		"//h2 or 0":                               true,
+		"true() = 'x'":                            true,
+	}
+	for expr, want := range tests {
+		expr, want := expr, want
+		t.Run(expr, func(t *testing.T) {
+			x, err := CompileXPath(expr)
+			require.NoError(t, err)
+			require.False(t, x.SelectsNodes())
+			require.Equal(t, want, x.Evaluate(doc))
+		})
+	}
+	require.True(t, math.IsNaN(MustCompileXPath("number('1e3')").Evaluate(doc).(float64)))
+}
+
+func TestXPathContext(t *testing.T) {
+	doc := parseTestDoc(t)
+	table := MustCompileXPath("//table[1]").Query(doc)
+	require.Equal(t, []string{"t1"}, ids([]*html.Node{table}))
+
+	rows := MustCompileXPath("tbody/tr[th]").QueryAll(table)
+	require.Equal(t, []string{"r1", "r2", "r3"}, ids(rows))
+
+	parent := MustCompileXPath("..").Query(table)
+	require.Equal(t, []string{"main"}, ids([]*html.Node{parent}))
+
+	require.Equal(t, []string{"doc"}, ids(MustCompileXPath("/html").QueryAll(table)))
+	require.Nil(t, MustCompileXPath("//ul").Query(doc))
+	require.Nil(t, MustCompileXPath("count(//tr)").QueryAll(doc))
+}
+
+func TestXPathErr(t *testing.T) {
+	tests := []struct {
+		input  string
+		offset int
+		token  string
+		msg    string
+	}{
+		{input: "//", offset: 2, token: "", msg: "expected node test"},
+		{input: "//div[", offset: 6, token: "", msg: "expected node test"},
+		{input: "//div[1", offset: 7, token: "", msg: "expected ']'"},
+		{input: "//div[@id='x]", offset: 10, token: "'", msg: "unterminated string"},
+		{input: "//div and", offset: 9, token: "", msg: "expected node test"},
+		{input: "//div foo", offset: 6, token: "foo", msg: "expected operator"},
+		{input: "foo(1)", offset: 0, token: "foo", msg: "unknown function"},
+		{input: "count(1)", offset: 6, token: "1", msg: "count() expects a node-set"},
+		{input: "contains('a')", offset: 0, token: "contains", msg: "wrong number of arguments for contains()"},
+		{input: "//a | 1", offset: 4, token: "|", msg: "union of non node-sets"},
+		{input: "'a'/b", offset: 3, token: "/", msg: "path from non node-set"},
+		{input: "1[1]", offset: 0, token: "1", msg: "predicate on non node-set"},
+		{input: "sibling::p", offset: 0, token: "sibling", msg: "unsupported axis"},
+		{input: "//svg:rect", offset: 2, token: "svg:rect", msg: "namespace prefixes not supported"},
+		{input: "$x", offset: 0, token: "$", msg: "variables not supported"},
+		{input: "//div#x", offset: 5, token: "#", msg: "unexpected character"},
+		{input: "//div)", offset: 5, token: ")", msg: "unexpected token"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			_, err := CompileXPath(tc.input)
+			ErrorIs(t, ErrInvalidXPath, err)
+			var xerr *XPathError
+			require.True(t, errors.As(err, &xerr))
+			require.Equal(t, tc.offset, xerr.Offset)
+			require.Equal(t, tc.token, xerr.Token)
+			require.Equal(t, tc.msg, xerr.Msg)
+		})
+	}
+	require.Panics(t, func() { MustCompileXPath("//") })
+}
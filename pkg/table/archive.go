@@ -0,0 +1,174 @@
+package table
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const archiveIndex = "index.jsonl"
+
+// Archive stores fetched pages in a local directory so that scrapes can
+// be reproduced and re-run after parser fixes. Page bodies are stored
+// gzipped once per content as <dir>/<id[:2]>/<id>.html.gz, with the hex
+// SHA-256 of the body as id. Every fetch is recorded as a line in
+// <dir>/index.jsonl with URL, status, headers and fetch time.
+type Archive struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// ArchiveEntry describes a page stored in an Archive.
+type ArchiveEntry struct {
+	ID      string      `json:"id"` // hex SHA-256 of the body
+	URL     string      `json:"url"`
+	Status  int         `json:"status"`
+	Header  http.Header `json:"header"`
+	Fetched time.Time   `json:"fetched"`
+}
+
+// OpenArchive opens the archive in dir, creating dir if needed.
+func OpenArchive(dir string) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Archive{dir: dir}, nil
+}
+
+func (a *Archive) objectPath(id string) string {
+	return filepath.Join(a.dir, id[:2], id+".html.gz")
+}
+
+// Store adds page to the archive. The body is only written if no page
+// with the same content has been stored before.
+func (a *Archive) Store(page *Page) (ArchiveEntry, error) {
+	sum := sha256.Sum256(page.Body)
+	e := ArchiveEntry{
+		ID:      hex.EncodeToString(sum[:]),
+		URL:     page.URL,
+		Status:  page.StatusCode,
+		Header:  page.Header,
+		Fetched: page.Fetched.UTC(),
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.writeObject(e.ID, page.Body); err != nil {
+		return ArchiveEntry{}, err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return ArchiveEntry{}, err
+	}
+	f, err := os.OpenFile(filepath.Join(a.dir, archiveIndex), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return ArchiveEntry{}, err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return ArchiveEntry{}, err
+	}
+	return e, f.Close()
+}
+
+// writeObject writes the gzipped body to a temporary file renamed to its
+// final name, so that readers never see partial objects.
+func (a *Archive) writeObject(id string, body []byte) error {
+	path := a.objectPath(id)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), id+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	w := gzip.NewWriter(tmp)
+	if _, err := w.Write(body); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Entries returns all archived fetches of url, or of all URLs if url is
+// empty, ordered by fetch time.
+func (a *Archive) Entries(url string) ([]ArchiveEntry, error) {
+	f, err := os.Open(filepath.Join(a.dir, archiveIndex))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []ArchiveEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var e ArchiveEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", archiveIndex, line, err)
+		}
+		if url == "" || e.URL == url {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Fetched.Before(entries[j].Fetched) })
+	return entries, nil
+}
+
+// Page returns the archived page for e. The body is checked against the
+// ID of e.
+func (a *Archive) Page(e ArchiveEntry) (*Page, error) {
+	if len(e.ID) != sha256.Size*2 {
+		return nil, fmt.Errorf("invalid archive id '%s'", e.ID)
+	}
+	f, err := os.Open(a.objectPath(e.ID))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(body); hex.EncodeToString(sum[:]) != e.ID {
+		return nil, fmt.Errorf("corrupt archive object %s", e.ID)
+	}
+	return &Page{
+		URL:          e.URL,
+		StatusCode:   e.Status,
+		Header:       e.Header,
+		Body:         body,
+		Fetched:      e.Fetched,
+		ETag:         e.Header.Get("ETag"),
+		LastModified: e.Header.Get("Last-Modified"),
+	}, nil
+}
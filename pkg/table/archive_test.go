@@ -0,0 +1,94 @@
+package table
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchive(t *testing.T) {
+	dir := tempDir(t)
+	a, err := OpenArchive(dir)
+	require.NoError(t, err)
+	fetched := time.Date(2020, 4, 5, 17, 0, 0, 0, time.UTC)
+	pages := []*Page{
+		{URL: "http://a", StatusCode: 200, Body: []byte("<p>2</p>"), Fetched: fetched.Add(time.Hour)},
+		{URL: "http://a", StatusCode: 200, Body: []byte("<p>1</p>"), Fetched: fetched, Header: http.Header{"Etag": {`"1"`}}},
+		{URL: "http://b", StatusCode: 200, Body: []byte("<p>1</p>"), Fetched: fetched},
+	}
+	for _, p := range pages {
+		_, err := a.Store(p)
+		require.NoError(t, err)
+	}
+	objects, err := filepath.Glob(filepath.Join(dir, "*", "*.html.gz"))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(objects))
+
+	entries, err := a.Entries("http://a")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, fetched, entries[0].Fetched)
+	page, err := a.Page(entries[0])
+	require.NoError(t, err)
+	require.Equal(t, "<p>1</p>", string(page.Body))
+	require.Equal(t, `"1"`, page.ETag)
+	require.Equal(t, "http://a", page.URL)
+
+	entries, err = a.Entries("")
+	require.NoError(t, err)
+	require.Equal(t, 3, len(entries))
+
+	require.NoError(t, ioutil.WriteFile(objects[0], []byte("not gzip"), 0644))
+	_, err = a.Page(entries[0])
+	require.Error(t, err)
+	_, err = a.Page(ArchiveEntry{ID: "../x"})
+	require.Error(t, err)
+}
+
+func TestArchiveEmpty(t *testing.T) {
+	a, err := OpenArchive(filepath.Join(tempDir(t), "archive"))
+	require.NoError(t, err)
+	entries, err := a.Entries("")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestFetchArchive(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := os.Open(filepath.Join("testdata", wikiFile))
+		require.NoError(t, err)
+		defer reader.Close()
+		w.Header().Set("Last-Modified", "Sun, 05 Apr 2020 17:03:01 GMT")
+		_, err = io.Copy(w, reader)
+		require.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	a, err := OpenArchive(tempDir(t))
+	require.NoError(t, err)
+	s := wikiScraper()
+	s.URL = ts.URL
+	s.Fetcher = NewFetcher()
+	s.Fetcher.Archive = a
+	want, _, err := s.ScrapeContext(context.Background())
+	require.NoError(t, err)
+
+	entries, err := a.Entries(ts.URL)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	require.Equal(t, "Sun, 05 Apr 2020 17:03:01 GMT", entries[0].Header.Get("Last-Modified"))
+	page, err := a.Page(entries[0])
+	require.NoError(t, err)
+	got, _, err := s.ScrapePage(page)
+	require.NoError(t, err)
+	require.Equal(t, want.Cells, got.Cells)
+	require.Equal(t, entries[0].Fetched, got.AsOf)
+}
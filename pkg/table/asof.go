@@ -0,0 +1,73 @@
+package table
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// compileAsOfPattern checks the as-of fields of s and compiles
+// AsOfPattern, which is nil if empty. Pattern and layout are only used
+// with AsOfCSSSelector.
+func compileAsOfPattern(s *Scraper) (*regexp.Regexp, error) {
+	if s.AsOfCSSSelector == "" {
+		if s.AsOfPattern != "" || s.AsOfLayout != "" {
+			return nil, fmt.Errorf("as of pattern or layout without as of css selector")
+		}
+		return nil, nil
+	}
+	if s.AsOfLayout == "" {
+		return nil, fmt.Errorf("as of selector without layout")
+	}
+	if s.AsOfPattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(s.AsOfPattern)
+	if err != nil {
+		return nil, fmt.Errorf("as of pattern: %w", err)
+	}
+	return re, nil
+}
+
+// getAsOf returns the data-as-of time found in the document with the
+// compiled Scraper.AsOfCSSSelector and AsOfPattern or the zero time if
+// absent.
+func (c *CompiledScraper) getAsOf(n *html.Node) (time.Time, error) {
+	if c.sel.asOf == nil {
+		return time.Time{}, nil
+	}
+	el := c.sel.asOf.Query(n)
+	if el == nil {
+		return time.Time{}, nil
+	}
+	text := strings.Join(strings.Fields(getText(el)), " ")
+	if c.asOfRe != nil {
+		m := c.asOfRe.FindStringSubmatch(text)
+		if len(m) < 2 {
+			return time.Time{}, nil
+		}
+		text = m[1]
+	}
+	asOf, err := time.Parse(c.def.AsOfLayout, text)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse as of date: %w", err)
+	}
+	return asOf.UTC(), nil
+}
+
+// getLastModified returns the time of the Last-Modified header if
+// Scraper.AsOfLastModified is set and the header is valid.
+func (s *Scraper) getLastModified(h http.Header) time.Time {
+	if !s.AsOfLastModified {
+		return time.Time{}
+	}
+	t, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
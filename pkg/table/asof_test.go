@@ -0,0 +1,87 @@
+package table
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func asOfWikiScraper() *Scraper {
+	s := wikiScraper()
+	s.AsOfCSSSelector = "div#covid19-container"
+	s.AsOfPattern = `As of ([0-9]+ [A-Za-z]+ [0-9]{4})`
+	s.AsOfLayout = "2 January 2006"
+	return s
+}
+
+func TestAsOf(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", wikiFile))
+	require.NoError(t, err)
+	defer r.Close()
+
+	table, _, err := asOfWikiScraper().scrapeFromReader(r)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2020, 4, 5, 0, 0, 0, 0, time.UTC), table.AsOf)
+	require.Equal(t, table.AsOf, table.date())
+}
+
+func TestAsOfErr(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", wikiFile))
+	require.NoError(t, err)
+	defer r.Close()
+
+	s := asOfWikiScraper()
+	s.AsOfLayout = "2006-01-02"
+	_, _, err = s.scrapeFromReader(r)
+	require.Error(t, err)
+
+	s.AsOfLayout = ""
+	require.Error(t, ValidateScraper(s))
+
+	s = asOfWikiScraper()
+	s.AsOfPattern = "As of ("
+	require.Error(t, ValidateScraper(s))
+
+	s = wikiScraper()
+	s.AsOfPattern = `As of ([0-9]+ [A-Za-z]+ [0-9]{4})`
+	require.EqualError(t, ValidateScraper(s), "as of pattern or layout without as of css selector")
+	s.AsOfPattern = ""
+	s.AsOfLayout = "2 January 2006"
+	require.Error(t, ValidateScraper(s))
+}
+
+func TestAsOfLastModified(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := os.Open(filepath.Join("testdata", wikiFile))
+		require.NoError(t, err)
+		defer reader.Close()
+		w.Header().Set("Last-Modified", "Sun, 05 Apr 2020 17:03:01 GMT")
+		_, err = io.Copy(w, reader)
+		require.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	s := wikiScraper()
+	s.URL = ts.URL
+	table, _, err := s.Scrape()
+	require.NoError(t, err)
+	require.True(t, table.AsOf.IsZero())
+
+	s.AsOfLastModified = true
+	table, _, err = s.Scrape()
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2020, 4, 5, 17, 3, 1, 0, time.UTC), table.AsOf)
+
+	s = asOfWikiScraper()
+	s.URL = ts.URL
+	s.AsOfLastModified = true
+	table, _, err = s.Scrape()
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2020, 4, 5, 0, 0, 0, 0, time.UTC), table.AsOf)
+}
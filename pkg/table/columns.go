@@ -0,0 +1,117 @@
+package table
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// mapsColumns reports whether ColumnDefs are bound to columns by header
+// text rather than by position.
+func (s *Scraper) mapsColumns() bool {
+	if s.MapColumnsByHeader {
+		return true
+	}
+	for _, colDef := range s.ColumnDefs {
+		if colDef.Header != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scraper) validateColumnMapping() error {
+	if !s.mapsColumns() {
+		return nil
+	}
+	if s.HeaderRowCount == 0 {
+		return fmt.Errorf("column mapping by header without header rows")
+	}
+	for i := range s.ColumnDefs {
+		if s.ColumnDefs[i].Skip {
+			continue
+		}
+		if _, err := s.headerPattern(i); err != nil {
+			return fmt.Errorf("column %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// headerPattern returns the regexp matching the header of ColumnDefs[i],
+// either ColumnDef.Header or HeaderColNames[i] if MapColumnsByHeader is set.
+func (s *Scraper) headerPattern(i int) (*regexp.Regexp, error) {
+	pattern := s.ColumnDefs[i].Header
+	if pattern == "" {
+		if !s.MapColumnsByHeader || i >= len(s.HeaderColNames) {
+			return nil, fmt.Errorf("no header pattern")
+		}
+		pattern = regexp.QuoteMeta(s.HeaderColNames[i])
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// resolveColumnDefs returns ColumnDefs rearranged to the columns of the
+// table with the given header rows. Columns without ColumnDef are skipped;
+// optional ColumnDefs without column are appended and counted in missing,
+// see padMissing.
+func (s *Scraper) resolveColumnDefs(headerRows [][]cell) (colDefs []ColumnDef, missing int, err error) {
+	header := getHeaderTexts(headerRows)
+	resolved := make([]ColumnDef, len(header))
+	for i := range resolved {
+		resolved[i] = ColumnDef{Skip: true}
+	}
+	var missingDefs []ColumnDef
+	for i, colDef := range s.ColumnDefs {
+		if colDef.Skip {
+			continue
+		}
+		re, err := s.headerPattern(i)
+		if err != nil {
+			return nil, 0, fmt.Errorf("column %d: %w", i, err)
+		}
+		var matches []int
+		for j, text := range header {
+			if re.MatchString(text) {
+				matches = append(matches, j)
+			}
+		}
+		switch {
+		case len(matches) > 1:
+			return nil, 0, fmt.Errorf("column '%s': header pattern '%s' matches %d columns: %q", colDef.TargetName, re, len(matches), header)
+		case len(matches) == 0 && colDef.Optional:
+			missingDefs = append(missingDefs, colDef)
+		case len(matches) == 0:
+			return nil, 0, fmt.Errorf("column '%s': no header matches '%s' in %q", colDef.TargetName, re, header)
+		case !resolved[matches[0]].Skip:
+			return nil, 0, fmt.Errorf("column '%s': header '%s' already bound to column '%s'", colDef.TargetName, header[matches[0]], resolved[matches[0]].TargetName)
+		default:
+			resolved[matches[0]] = colDef
+		}
+	}
+	return append(resolved, missingDefs...), len(missingDefs), nil
+}
+
+// padMissing appends n missing cells to every row.
+func padMissing(rows [][]cell, n int) [][]cell {
+	if n <= 0 {
+		return rows
+	}
+	padded := make([][]cell, len(rows))
+	for i, row := range rows {
+		padded[i] = append(append([]cell(nil), row...), make([]cell, n)...)
+		for j := len(row); j < len(padded[i]); j++ {
+			padded[i][j].missing = true
+		}
+	}
+	return padded
+}
+
+func getTargetColNames(colDefs []ColumnDef) []string {
+	var names []string
+	for _, colDef := range colDefs {
+		if !colDef.Skip {
+			names = append(names, colDef.TargetName)
+		}
+	}
+	return names
+}
@@ -0,0 +1,94 @@
+package table
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const insertedColumnDoc = `<table>
+<tr><th rowspan="2">Country</th><th colspan="2">Cases</th><th rowspan="2">Tests</th><th rowspan="2">Deaths</th></tr>
+<tr><th>Total</th><th>New</th></tr>
+<tr><td>Italy</td><td>1,000</td><td>10</td><td>5,000</td><td>100</td></tr>
+<tr><td>Spain</td><td>2,000</td><td>20</td><td>-</td><td>200</td></tr>
+</table>`
+
+func mappedScraper() *Scraper {
+	return &Scraper{
+		CSSSelector: "table",
+		ColumnDefs: []ColumnDef{
+			{TargetName: "deaths", Type: IntType, Header: "^deaths"},
+			{TargetName: "country", Type: StringType, Header: "country"},
+			{TargetName: "cases", Type: IntType, Header: "cases total"},
+			{TargetName: "recoveries", Type: IntType, Header: "recover", Optional: true},
+		},
+		HeaderRowCount: 2,
+	}
+}
+
+func TestMapColumns(t *testing.T) {
+	s := mappedScraper()
+	require.NoError(t, ValidateScraper(s))
+	table, report, err := s.scrapeFromReader(strings.NewReader(insertedColumnDoc))
+	require.NoError(t, err)
+	require.Empty(t, report.Rejected)
+	require.Equal(t, []string{"deaths", "country", "cases", "recoveries"}, table.GetColumnNames())
+	require.Equal(t, [][]interface{}{{100, "Italy", 1000, 0}, {200, "Spain", 2000, 0}}, table.Cells)
+
+	s.TargetColNames = []string{"country", "cases", "deaths", "recoveries"}
+	table, _, err = s.scrapeFromReader(strings.NewReader(insertedColumnDoc))
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"Italy", 1000, 100, 0}, table.Cells[0])
+}
+
+func TestMapColumnsByHeaderColNames(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", mapFile))
+	require.NoError(t, err)
+	defer r.Close()
+
+	s := mapScraper()
+	s.MapColumnsByHeader = true
+	s.HeaderColNames = []string{"Location", "Confirmed cases", "per 1M", "Recovered", "Deaths"}
+	s.ColumnDefs[0], s.ColumnDefs[4] = s.ColumnDefs[4], s.ColumnDefs[0]
+	s.HeaderColNames[0], s.HeaderColNames[4] = s.HeaderColNames[4], s.HeaderColNames[0]
+	require.NoError(t, ValidateScraper(s))
+
+	table, _, err := s.scrapeFromReader(r)
+	require.NoError(t, err)
+	require.Equal(t, 168, len(table.Cells))
+	require.Equal(t, []string{"deaths", "cases", "cases1m", "recovered", "country"}, table.GetColumnNames())
+	require.Equal(t, []interface{}{12964, 303594, 43.09, 94625, "Worldwide"}, table.Cells[0])
+}
+
+func TestMapColumnsErr(t *testing.T) {
+	tests := map[string]func(s *Scraper){
+		"missing":   func(s *Scraper) { s.ColumnDefs[3].Optional = false },
+		"ambiguous": func(s *Scraper) { s.ColumnDefs[2].Header = "cases" },
+		"bound":     func(s *Scraper) { s.ColumnDefs[0].Header = "country" },
+	}
+	for name, modify := range tests {
+		modify := modify
+		t.Run(name, func(t *testing.T) {
+			s := mappedScraper()
+			modify(s)
+			require.NoError(t, ValidateScraper(s))
+			_, _, err := s.scrapeFromReader(strings.NewReader(insertedColumnDoc))
+			require.Error(t, err)
+		})
+	}
+
+	s := mappedScraper()
+	s.HeaderRowCount = 0
+	require.Error(t, ValidateScraper(s))
+
+	s = mappedScraper()
+	s.ColumnDefs[0].Header = "("
+	require.Error(t, ValidateScraper(s))
+
+	s = mappedScraper()
+	s.ColumnDefs[0].Header = ""
+	require.Error(t, ValidateScraper(s))
+}
@@ -0,0 +1,145 @@
+package table
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// CompiledScraper is a validated Scraper with compiled selectors, patterns
+// and column definitions, as returned by CompileScraper and LoadScrapers.
+// Scraping does not change it, so that it can be reused for any number
+// of pages, also concurrently.
+type CompiledScraper struct {
+	def     Scraper     // copy of the definition
+	sel     selectors   // compiled def.CSSSelector, XPath and AsOfCSSSelector
+	colDefs []ColumnDef // def.ColumnDefs with compiled transforms and selectors
+
+	asOfRe     *regexp.Regexp // def.AsOfPattern, nil if empty
+	revisionRe *regexp.Regexp // def.RevisionPattern, nil if empty
+}
+
+// CompileScraper validates s and compiles its selectors, patterns and
+// column definitions. Later changes to the fields of s do not affect the
+// result.
+func CompileScraper(s *Scraper) (*CompiledScraper, error) {
+	if err := validateScraper(s); err != nil {
+		return nil, err
+	}
+	c := &CompiledScraper{def: s.clone()}
+	var err error
+	if c.sel, err = s.compileSelectors(); err != nil {
+		return nil, err
+	}
+	if c.asOfRe, err = compileAsOfPattern(s); err != nil {
+		return nil, err
+	}
+	if c.revisionRe, err = compileRevisionPattern(s.RevisionPattern); err != nil {
+		return nil, err
+	}
+	if c.colDefs, err = compileColumnDefs(s.ColumnDefs); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// clone returns a copy of s that does not share the slice fields of s.
+func (s *Scraper) clone() Scraper {
+	c := *s
+	c.ColumnDefs = append([]ColumnDef(nil), s.ColumnDefs...)
+	c.HeaderColNames = append([]string(nil), s.HeaderColNames...)
+	c.TargetColNames = append([]string(nil), s.TargetColNames...)
+	c.KeyColNames = append([]string(nil), s.KeyColNames...)
+	return c
+}
+
+// Scraper returns a copy of the definition c has been compiled from.
+func (c *CompiledScraper) Scraper() *Scraper {
+	s := c.def.clone()
+	return &s
+}
+
+// WithURL returns a copy of c for the page at url, e.g. a saved copy of
+// the page c has been defined for. The compiled parts are shared.
+func (c *CompiledScraper) WithURL(url string) *CompiledScraper {
+	result := *c
+	result.def.URL = url
+	return &result
+}
+
+func (c *CompiledScraper) Scrape() (*Table, *Report, error) {
+	return c.ScrapeContext(context.Background())
+}
+
+// ScrapeContext fetches and parses the page at the scraper URL. Fetching
+// is cancelled, including retries, when ctx is done. The page is
+// remembered for conditional requests of c once parsed; callers that
+// fail to store the returned table should call Forget.
+func (c *CompiledScraper) ScrapeContext(ctx context.Context) (*Table, *Report, error) {
+	start := time.Now()
+	fetcher := c.def.GetFetcher()
+	page, err := fetcher.FetchAs(ctx, c.def.URL, c.def.fetchKey())
+	if err != nil {
+		return nil, nil, err
+	}
+	if page.NotModified {
+		return nil, nil, ErrNotModified
+	}
+	t, report, err := c.scrapePage(page)
+	if err != nil {
+		return nil, report, err
+	}
+	t.Run.Started = start.UTC()
+	t.Run.Duration = time.Since(start)
+	fetcher.Remember(page)
+	return t, report, nil
+}
+
+// ScrapePage parses a previously fetched page, e.g. from an Archive. The
+// data date falls back to the fetch time of the page rather than the
+// current time.
+func (c *CompiledScraper) ScrapePage(page *Page) (*Table, *Report, error) {
+	start := time.Now()
+	t, report, err := c.scrapePage(page)
+	if err != nil {
+		return nil, report, err
+	}
+	if t.AsOf.IsZero() {
+		t.AsOf = page.Fetched
+	}
+	t.Run.Started = page.Fetched
+	t.Run.Duration = time.Since(start)
+	return t, report, nil
+}
+
+// ScrapeReader parses the HTML page read from r, e.g. a saved copy of
+// the page at the scraper URL.
+func (c *CompiledScraper) ScrapeReader(r io.Reader) (*Table, *Report, error) {
+	return c.scrapeFromReader(r)
+}
+
+// ScrapeNode extracts the table from the parsed HTML document n.
+func (c *CompiledScraper) ScrapeNode(n *html.Node) (*Table, *Report, error) {
+	return c.scrapeNode(n)
+}
+
+func (c *CompiledScraper) scrapePage(page *Page) (*Table, *Report, error) {
+	t, report, err := c.scrapeFromReader(bytes.NewReader(page.Body))
+	if err != nil {
+		return nil, report, err
+	}
+	if t.AsOf.IsZero() {
+		t.AsOf = c.def.getLastModified(page.Header)
+	}
+	return t, report, nil
+}
+
+// Forget makes the next Scrape fetch the scraper URL unconditionally,
+// e.g. after the scraped table could not be persisted.
+func (c *CompiledScraper) Forget() {
+	c.def.Forget()
+}
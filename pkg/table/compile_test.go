@@ -0,0 +1,55 @@
+package table
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileScraper(t *testing.T) {
+	s := wikiScraper()
+	c, err := CompileScraper(s)
+	require.NoError(t, err)
+	require.Equal(t, wikiScraper(), c.Scraper())
+
+	// the compiled scraper does not see later changes to its definition
+	s.CSSSelector = "div$"
+	s.ColumnDefs[1].Type = "complex128"
+	s.TargetTableName = "changed"
+	require.Equal(t, wikiScraper(), c.Scraper())
+	require.Error(t, ValidateScraper(s))
+
+	var wg sync.WaitGroup
+	tables := make([]*Table, 3)
+	for i := range tables {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f, err := os.Open(filepath.Join("testdata", wikiFile))
+			require.NoError(t, err)
+			defer f.Close()
+			tables[i], _, err = c.ScrapeReader(f)
+			require.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, wikiScraper().TargetTableName, tables[0].Name)
+	require.NotEmpty(t, tables[0].Cells)
+	for _, table := range tables[1:] {
+		require.Equal(t, tables[0].Cells, table.Cells)
+	}
+
+	c2 := c.WithURL("file://saved.htm")
+	require.Equal(t, "file://saved.htm", c2.Scraper().URL)
+	require.Equal(t, wikiScraper().URL, c.Scraper().URL)
+}
+
+func TestCompileScraperErr(t *testing.T) {
+	s := wikiScraper()
+	s.ColumnDefs[2].Selector = "span$"
+	_, err := CompileScraper(s)
+	require.EqualError(t, err, `column 2: invalid selector at offset 4 near "$" in "span$": unexpected character`)
+}
@@ -0,0 +1,59 @@
+package table
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds scraper definitions as read from a YAML or JSON file, e.g.
+//
+//	scrapers:
+//	- url: https://en.wikipedia.org/wiki/...
+//	  css_selector: div#covid19-container table.wikitable
+//	  column_defs:
+//	  - skip: true
+//	  - {target_name: country, type: string, truncate_from: "["}
+//	  - {target_name: cases, type: int, zero_values: ["-"]}
+//	  target_table_name: entries
+//
+// JSON files are read with the same field names as JSON is valid YAML.
+type Config struct {
+	Scrapers []*Scraper `yaml:"scrapers"`
+}
+
+// LoadScrapers reads and compiles the scraper definitions of a config
+// file, see ParseScrapers.
+func LoadScrapers(filename string) ([]*CompiledScraper, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	scrapers, err := ParseScrapers(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return scrapers, nil
+}
+
+// ParseScrapers parses and compiles scraper definitions, so that they
+// are validated once and can be used for any number of scrapes.
+func ParseScrapers(b []byte) ([]*CompiledScraper, error) {
+	cfg := Config{}
+	if err := yaml.UnmarshalStrict(b, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Scrapers) == 0 {
+		return nil, fmt.Errorf("no scrapers defined")
+	}
+	scrapers := make([]*CompiledScraper, len(cfg.Scrapers))
+	for i, s := range cfg.Scrapers {
+		c, err := CompileScraper(s)
+		if err != nil {
+			return nil, fmt.Errorf("scraper %d (%s): %w", i, s.TargetTableName, err)
+		}
+		scrapers[i] = c
+	}
+	return scrapers, nil
+}
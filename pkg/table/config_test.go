@@ -0,0 +1,76 @@
+package table
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/juliaogris/covid19/pkg/htmlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadScrapers(t *testing.T) {
+	tests := map[string]struct {
+		inputFile string
+		want      []*Scraper
+	}{
+		"yaml": {inputFile: "scrapers.yaml", want: []*Scraper{wikiScraper(), mapScraper()}},
+		"json": {inputFile: "scrapers.json", want: []*Scraper{wikiScraper()}},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			got, err := LoadScrapers(filepath.Join("testdata", tc.inputFile))
+			require.NoError(t, err)
+			require.Equal(t, len(tc.want), len(got))
+			for i, want := range tc.want {
+				require.Equal(t, want, got[i].Scraper())
+			}
+		})
+	}
+}
+
+func TestParseScrapersErr(t *testing.T) {
+	tests := map[string]string{
+		"empty":          "scrapers: []",
+		"unknown_field":  "scrapers: [{url: x, css_selector: table, column_defs: [{target_name: a, type: string}], colour: red}]",
+		"unknown_type":   "scrapers: [{url: x, css_selector: table, column_defs: [{target_name: a, type: complex128}]}]",
+		"bad_layout":     "scrapers: [{url: x, css_selector: table, column_defs: [{target_name: a, type: int, layout: '2006'}]}]",
+		"string_number":  "scrapers: [{url: x, css_selector: table, column_defs: [{target_name: a, type: string, decimal_sep: ','}]}]",
+		"same_seps":      "scrapers: [{url: x, css_selector: table, column_defs: [{target_name: a, type: float64, decimal_sep: ','}]}]",
+		"no_target_name": "scrapers: [{url: x, css_selector: table, column_defs: [{type: int}]}]",
+		"no_column_defs": "scrapers: [{url: x, css_selector: table}]",
+		"bad_selector":   "scrapers: [{url: x, css_selector: div$, column_defs: [{target_name: a, type: string}]}]",
+		"bad_as_of":      "scrapers: [{url: x, css_selector: table, column_defs: [{target_name: a, type: string}], as_of_css_selector: 'div >', as_of_layout: x}]",
+		"bad_xpath":      "scrapers: [{url: x, xpath: '//table[', column_defs: [{target_name: a, type: string}]}]",
+		"xpath_number":   "scrapers: [{url: x, xpath: 'count(//table)', column_defs: [{target_name: a, type: string}]}]",
+		"css_and_xpath":  "scrapers: [{url: x, css_selector: table, xpath: //table, column_defs: [{target_name: a, type: string}]}]",
+		"bad_header":     "scrapers: [{url: x, css_selector: table, column_defs: [{target_name: a, type: string}], header_col_names: [a]}]",
+	}
+
+	for name, input := range tests {
+		input := input
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseScrapers([]byte(input))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestParseScrapersSelectorErr(t *testing.T) {
+	input := "scrapers: [{url: x, css_selector: 'div > table$', column_defs: [{target_name: a, type: string}], target_table_name: t}]"
+	_, err := ParseScrapers([]byte(input))
+	var serr *htmlx.SelectorError
+	require.True(t, errors.As(err, &serr))
+	require.Equal(t, 11, serr.Offset)
+	require.Equal(t, `scraper 0 (t): css selector: invalid selector at offset 11 near "$" in "div > table$": unexpected character`, err.Error())
+}
+
+func TestParseScrapersNumberFormat(t *testing.T) {
+	input := `scrapers: [{url: x, css_selector: table, column_defs: [{target_name: a, type: int, thousands_sep: ".", decimal_sep: ",", prefixes: ["~"], magnitudes: true}]}]`
+	scrapers, err := ParseScrapers([]byte(input))
+	require.NoError(t, err)
+	want := NumberFormat{ThousandsSep: ".", DecimalSep: ",", Prefixes: []string{"~"}, Magnitudes: true}
+	require.Equal(t, want, scrapers[0].Scraper().ColumnDefs[0].NumberFormat)
+}
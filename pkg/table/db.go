@@ -1,9 +1,9 @@
 package table
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"reflect"
 	"regexp"
 	"strings"
 	"time"
@@ -11,31 +11,60 @@ import (
 	"github.com/lib/pq"
 )
 
-func Persist(connStr string, t *Table) error {
+type PostgresSink struct {
+	db *sql.DB
+
+	Migrate          bool // add new columns to existing table instead of failing
+	AllowDestructive bool // with Migrate, also drop columns and change column types
+}
+
+func OpenPostgresSink(connStr string) (*PostgresSink, error) {
+	return openPostgresSink(context.Background(), connStr)
+}
+
+func openPostgresSink(ctx context.Context, connStr string) (*PostgresSink, error) {
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err := db.Ping(); err != nil {
-		return err
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
 	}
+	return &PostgresSink{db: db}, nil
+}
 
-	if err := setupSchema(db, t); err != nil {
+func (p *PostgresSink) SetupSchema(ctx context.Context, t *Table) error {
+	if !p.Migrate {
+		return setupSchema(ctx, p.db, t)
+	}
+	if err := createSchema(ctx, p.db, t); err != nil {
+		return err
+	}
+	if err := migrateSchema(ctx, p.db, t, p.AllowDestructive); err != nil {
 		return err
 	}
-	return insertRows(db, t)
+	return validateSchema(ctx, p.db, t)
+}
+
+func (p *PostgresSink) Write(ctx context.Context, t *Table) error {
+	return insertRows(ctx, p.db, t)
+}
+
+func (p *PostgresSink) Close() error {
+	return p.db.Close()
 }
 
 var identifierRe = regexp.MustCompile("^[_a-zA-Z]+[_a-zA-Z0-9]*$")
 
-func setupSchema(db *sql.DB, t *Table) error {
-	if err := createSchema(db, t); err != nil {
+func setupSchema(ctx context.Context, db *sql.DB, t *Table) error {
+	if err := createSchema(ctx, db, t); err != nil {
 		return err
 	}
-	return validateSchema(db, t)
+	return validateSchema(ctx, db, t)
 }
 
-func createSchema(db *sql.DB, t *Table) error {
+func createSchema(ctx context.Context, db *sql.DB, t *Table) error {
 	if !identifierRe.MatchString(t.Name) {
 		return fmt.Errorf("invalid table name, must be SQL identifier")
 	}
@@ -43,15 +72,53 @@ func createSchema(db *sql.DB, t *Table) error {
 	if err != nil {
 		return err
 	}
+	if _, err := db.ExecContext(ctx, createRunsTableStmt); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, createRejectsTableStmt); err != nil {
+		return err
+	}
 	stmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
    		id serial PRIMARY KEY,
 	   	date timestamp NOT NULL,
+	   	run_id integer REFERENCES %s (id),
 	   	%s
-	)`, t.Name, cols)
-	_, err = db.Exec(stmt)
-	return err
+	)`, t.Name, runsTable, cols)
+	if _, err = db.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	// tables created before scrape runs were recorded
+	stmt = fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS run_id integer REFERENCES %s (id)", t.Name, runsTable)
+	if _, err = db.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	return createKeyIndex(ctx, db, t, pqIndexDefQuery)
 }
 
+var createRunsTableStmt = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id serial PRIMARY KEY,
+		table_name text NOT NULL,
+		url text NOT NULL,
+		revision text NOT NULL,
+		scraper_version text NOT NULL,
+		started timestamp NOT NULL,
+		duration_ms bigint NOT NULL,
+		row_count integer NOT NULL,
+		rejected_count integer NOT NULL
+	)`, runsTable)
+
+func insertRun(ctx context.Context, txn *sql.Tx, run *Run) (int64, error) {
+	q := fmt.Sprintf(`INSERT INTO %s
+		(table_name, url, revision, scraper_version, started, duration_ms, row_count, rejected_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`, runsTable)
+	var id int64
+	err := txn.QueryRowContext(ctx, q, run.TableName, run.URL, run.Revision, run.ScraperVersion,
+		run.Started, run.Duration.Milliseconds(), run.RowCount, run.RejectedCount).Scan(&id)
+	return id, err
+}
+
+var insertRejectStmt = fmt.Sprintf("INSERT INTO %s (run_id, row_index, cells, error) VALUES ($1, $2, $3, $4)", rejectsTable)
+
 func getPQCols(cols []Column) (string, error) {
 	s := make([]string, len(cols))
 	var err error
@@ -76,26 +143,35 @@ func getPQCol(col Column) (string, error) {
 	return fmt.Sprintf("%s %s", col.Name, pqType), nil
 }
 
-func getPQType(k reflect.Kind) (string, error) {
-	switch k {
-	case reflect.String:
+// getPQType returns the Postgres type as in information_schema.columns.
+func getPQType(t ColType) (string, error) {
+	switch t {
+	case StringType:
 		return "text", nil
-	case reflect.Int, reflect.Int64:
+	case IntType, Int64Type:
 		return "bigint", nil
-	case reflect.Float64:
+	case Float64Type, PercentType:
 		return "double precision", nil
+	case BoolType:
+		return "boolean", nil
+	case DateType:
+		return "date", nil
+	case TimeType:
+		return "timestamp with time zone", nil
+	case DecimalType:
+		return "numeric", nil
 	}
-	return "", fmt.Errorf("unknown kind %s", k)
+	return "", fmt.Errorf("unknown column type '%s'", t)
 }
 
-func validateSchema(db *sql.DB, t *Table) error {
+func validateSchema(ctx context.Context, db *sql.DB, t *Table) error {
 	types, err := getPQTypeMap(t)
 	if err != nil {
 		return err
 	}
 
 	q := "SELECT column_name, data_type, column_default FROM information_schema.columns WHERE table_name = $1;"
-	rows, err := db.Query(q, t.Name)
+	rows, err := db.QueryContext(ctx, q, t.Name)
 	if err != nil {
 		return err
 	}
@@ -131,7 +207,7 @@ func validateSchemaRow(rows *sql.Rows, types map[string]string) error {
 }
 
 func getPQTypeMap(t *Table) (map[string]string, error) {
-	m := map[string]string{"id": "integer", "date": "timestamp without time zone"}
+	m := map[string]string{"id": "integer", "date": "timestamp without time zone", "run_id": "integer"}
 	for _, col := range t.Columns {
 		t, err := getPQType(col.Type)
 		if err != nil {
@@ -142,42 +218,75 @@ func getPQTypeMap(t *Table) (map[string]string, error) {
 	return m, nil
 }
 
-func insertRows(db *sql.DB, t *Table) error {
-	date := time.Now().UTC()
+func insertRows(ctx context.Context, db *sql.DB, t *Table) error {
+	if err := checkUniqueKey(t); err != nil {
+		return err
+	}
+	date := t.date()
 
-	txn, err := db.Begin()
+	txn, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	colNames := t.GetColumnNames()
-	s := append([]string{"date"}, colNames...)
-	stmt, err := txn.Prepare(pq.CopyIn(t.Name, s...))
-	if err != nil {
+	if err := insertRowsTxn(ctx, txn, t, date); err != nil {
+		_ = txn.Rollback()
 		return err
 	}
+	return txn.Commit()
+}
 
-	for _, row := range t.Cells {
-		vals := append([]interface{}{date}, row...)
-		_, err = stmt.Exec(vals...)
+func insertRowsTxn(ctx context.Context, txn *sql.Tx, t *Table, date time.Time) error {
+	if t.SkipUnchanged {
+		unchanged, err := isUnchangedSnapshot(ctx, txn, t)
 		if err != nil {
 			return err
 		}
+		if unchanged {
+			return ErrUnchanged
+		}
 	}
-
-	_, err = stmt.Exec()
+	run := getRun(t)
+	runID, err := insertRun(ctx, txn, run)
 	if err != nil {
 		return err
 	}
+	run.ID = runID
+	if err := insertRejects(ctx, txn, insertRejectStmt, run); err != nil {
+		return err
+	}
+	if len(t.Key) == 0 {
+		return copyRows(ctx, txn, t.Name, t, date, runID)
+	}
+	staging := t.Name + "_staging"
+	stmt := fmt.Sprintf("CREATE TEMP TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP", staging, t.Name)
+	if _, err := txn.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	if err := copyRows(ctx, txn, staging, t, date, runID); err != nil {
+		return err
+	}
+	_, err = txn.ExecContext(ctx, getUpsertStmt(t, staging))
+	return err
+}
 
-	err = stmt.Close()
+func copyRows(ctx context.Context, txn *sql.Tx, tableName string, t *Table, date time.Time, runID int64) error {
+	stmt, err := txn.PrepareContext(ctx, pq.CopyIn(tableName, getInsertColNames(t)...))
 	if err != nil {
 		return err
 	}
 
-	err = txn.Commit()
+	for _, row := range t.Cells {
+		vals := append([]interface{}{date, runID}, row...)
+		_, err = stmt.ExecContext(ctx, vals...)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = stmt.ExecContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return stmt.Close()
 }
@@ -0,0 +1,334 @@
+package table
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultUserAgent identifies the scraper as required by the Wikimedia
+// User-Agent policy: https://meta.wikimedia.org/wiki/User-Agent_policy
+const DefaultUserAgent = "covid19-scraper/1.0 (https://github.com/juliaogris/covid19) Go-http-client/1.1"
+
+// ErrNotModified is returned by Scraper.Scrape if the page has not
+// changed since it was last scraped successfully, according to its ETag
+// or Last-Modified header. Nothing is parsed or persisted then.
+var ErrNotModified = errors.New("page not modified since last scrape")
+
+// DefaultFetcher is used by scrapers without Fetcher.
+var DefaultFetcher = NewFetcher()
+
+// Fetcher fetches pages over HTTP. Network errors, 429 and 5xx responses
+// are retried with exponential backoff and jitter. With Conditional set,
+// ETag and Last-Modified of pages remembered with Remember are sent as
+// If-None-Match and If-Modified-Since.
+type Fetcher struct {
+	Client      *http.Client  // http.DefaultClient if nil
+	Timeout     time.Duration // per attempt, no timeout if 0
+	Retries     int           // retries after the first attempt
+	MinBackoff  time.Duration // wait before first retry, doubled for every further retry
+	MaxBackoff  time.Duration // maximum wait between retries, also for Retry-After
+	UserAgent   string
+	Conditional bool     // send conditional requests for remembered pages
+	Archive     *Archive // store all fetched pages if set
+
+	mu         sync.Mutex
+	validators map[string]validators
+	sleep      func(context.Context, time.Duration) error // sleepContext, replaced in tests
+}
+
+// Page is a fetched web page.
+type Page struct {
+	URL          string
+	StatusCode   int
+	Header       http.Header
+	Body         []byte
+	Fetched      time.Time
+	NotModified  bool   // 304 response to a conditional request, Body is empty
+	Key          string // key of the validators used and stored by Remember, see FetchAs
+	ETag         string
+	LastModified string
+}
+
+type validators struct {
+	etag         string
+	lastModified string
+}
+
+// StatusError is returned for responses with unexpected status code.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GET %s: %s", e.URL, e.Status)
+}
+
+// NewFetcher returns a Fetcher with 30 seconds timeout, 3 retries, 1 to
+// 30 seconds backoff, DefaultUserAgent and conditional requests.
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		Timeout:     30 * time.Second,
+		Retries:     3,
+		MinBackoff:  time.Second,
+		MaxBackoff:  30 * time.Second,
+		UserAgent:   DefaultUserAgent,
+		Conditional: true,
+	}
+}
+
+// Fetch gets url, retrying temporary failures until ctx is done.
+// Responses other than 200 and, for conditional requests, 304 result in
+// a *StatusError. file:// URLs are read from the local file system.
+func (f *Fetcher) Fetch(ctx context.Context, url string) (*Page, error) {
+	return f.FetchAs(ctx, url, url)
+}
+
+// FetchAs is Fetch with conditional requests based on the validators
+// remembered for key rather than for url, so that several consumers of
+// the same page, e.g. scrapers of different tables, do not hide changes
+// from each other.
+func (f *Fetcher) FetchAs(ctx context.Context, url, key string) (*Page, error) {
+	if strings.HasPrefix(url, "file://") {
+		page, err := fetchFile(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		page.Key = key
+		return page, f.archive(page)
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		var page *Page
+		var retryAfter time.Duration
+		page, retryAfter, err = f.fetchOnce(ctx, url, key)
+		if err == nil {
+			return page, f.archive(page)
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if !isTemporary(err) || attempt >= f.Retries {
+			break
+		}
+		if err := f.wait(ctx, attempt, retryAfter); err != nil {
+			return nil, err
+		}
+	}
+	if f.Retries > 0 && isTemporary(err) {
+		return nil, fmt.Errorf("%w (after %d retries)", err, f.Retries)
+	}
+	return nil, err
+}
+
+func (f *Fetcher) fetchOnce(ctx context.Context, url, key string) (*Page, time.Duration, error) {
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
+	conditional := false
+	if v, ok := f.remembered(key); ok && f.Conditional {
+		conditional = true
+		if v.etag != "" {
+			req.Header.Set("If-None-Match", v.etag)
+		}
+		if v.lastModified != "" {
+			req.Header.Set("If-Modified-Since", v.lastModified)
+		}
+	}
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	page := &Page{
+		URL:          url,
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header,
+		Fetched:      time.Now().UTC(),
+		Key:          key,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		if page.Body, err = ioutil.ReadAll(resp.Body); err != nil {
+			return nil, 0, err
+		}
+		return page, 0, nil
+	case resp.StatusCode == http.StatusNotModified && conditional:
+		page.NotModified = true
+		return page, 0, nil
+	}
+	statusErr := &StatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	return nil, retryAfter(resp.Header), statusErr
+}
+
+// fetchFile reads the file of a file:// URL, e.g. a saved page.
+// Conditional requests do not apply to files.
+func fetchFile(ctx context.Context, rawURL string) (*Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("unsupported host '%s' in file URL %s", u.Host, rawURL)
+	}
+	body, err := ioutil.ReadFile(filepath.FromSlash(u.Path))
+	if err != nil {
+		return nil, err
+	}
+	return &Page{
+		URL:        rawURL,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       body,
+		Fetched:    time.Now().UTC(),
+	}, nil
+}
+
+// isTemporary reports whether a request failing with err may succeed
+// when retried.
+func isTemporary(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	// *url.Error is a net.Error itself, also for malformed URLs and
+	// unsupported schemes, so look at the error it wraps.
+	var urlErr *neturl.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// wait sleeps before retry attempt+1 for a random duration between half
+// and all of the exponential backoff, or for retryAfter if longer. It
+// returns early with the context error if ctx is done.
+func (f *Fetcher) wait(ctx context.Context, attempt int, retryAfter time.Duration) error {
+	d := f.MinBackoff << uint(attempt)
+	if d <= 0 || (f.MaxBackoff > 0 && d > f.MaxBackoff) {
+		d = f.MaxBackoff
+	}
+	if d > 0 {
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	}
+	if retryAfter > d {
+		d = retryAfter
+	}
+	if f.MaxBackoff > 0 && d > f.MaxBackoff {
+		d = f.MaxBackoff
+	}
+	sleep := f.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	return sleep(ctx, d)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryAfter returns the duration of a Retry-After header in seconds.
+// HTTP dates are not supported and return 0.
+func retryAfter(h http.Header) time.Duration {
+	secs, err := strconv.Atoi(h.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+func (f *Fetcher) archive(page *Page) error {
+	if f.Archive == nil || page.NotModified {
+		return nil
+	}
+	if _, err := f.Archive.Store(page); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	return nil
+}
+
+// Remember stores the ETag and Last-Modified header of page for
+// conditional requests under page.Key. It should be called once page has
+// been processed successfully, so that failures are retried with the next
+// fetch; otherwise the validators must be dropped again with Forget.
+func (f *Fetcher) Remember(page *Page) {
+	if page.ETag == "" && page.LastModified == "" {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.validators == nil {
+		f.validators = map[string]validators{}
+	}
+	key := page.Key
+	if key == "" {
+		key = page.URL
+	}
+	f.validators[key] = validators{etag: page.ETag, lastModified: page.LastModified}
+}
+
+// Forget removes the stored ETag and Last-Modified header for key, the
+// URL for pages fetched with Fetch, so that the next fetch is
+// unconditional.
+func (f *Fetcher) Forget(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.validators, key)
+}
+
+func (f *Fetcher) remembered(key string) (validators, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.validators[key]
+	return v, ok
+}
@@ -0,0 +1,239 @@
+package table
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testFetcher(sleeps *[]time.Duration) *Fetcher {
+	f := NewFetcher()
+	f.sleep = func(_ context.Context, d time.Duration) error {
+		*sleeps = append(*sleeps, d)
+		return nil
+	}
+	return f
+}
+
+func TestFetchRetry(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, DefaultUserAgent, r.UserAgent())
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_, _ = io.WriteString(w, "<table></table>")
+		}
+	}))
+	defer ts.Close()
+
+	var sleeps []time.Duration
+	page, err := testFetcher(&sleeps).Fetch(context.Background(), ts.URL)
+	require.NoError(t, err)
+	require.Equal(t, "<table></table>", string(page.Body))
+	require.Equal(t, http.StatusOK, page.StatusCode)
+	require.Equal(t, int32(3), requests)
+	require.Equal(t, 2, len(sleeps))
+	require.True(t, sleeps[0] >= 500*time.Millisecond && sleeps[0] <= time.Second, sleeps[0])
+	require.Equal(t, 5*time.Second, sleeps[1])
+}
+
+func TestFetchErr(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	var sleeps []time.Duration
+	f := testFetcher(&sleeps)
+	_, err := f.Fetch(context.Background(), ts.URL+"/missing")
+	var statusErr *StatusError
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	require.Equal(t, int32(1), requests)
+	require.Empty(t, sleeps)
+
+	_, err = f.Fetch(context.Background(), ts.URL)
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, http.StatusBadGateway, statusErr.StatusCode)
+	require.Equal(t, int32(5), requests)
+	require.Equal(t, 3, len(sleeps))
+	for i, d := range sleeps {
+		max := time.Second << uint(i)
+		require.True(t, d >= max/2 && d <= max, d)
+	}
+}
+
+func TestFetchRetryNetErr(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	closedURL := ts.URL
+	ts.Close()
+	tests := map[string]struct {
+		url     string
+		retries int
+	}{
+		"refused":            {url: closedURL, retries: 3},
+		"unsupported_scheme": {url: "ftp://example.com/covid19"},
+		"malformed":          {url: "http://[::1"},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var sleeps []time.Duration
+			f := testFetcher(&sleeps)
+			_, err := f.Fetch(context.Background(), tc.url)
+			require.Error(t, err)
+			require.Equal(t, tc.retries, len(sleeps))
+		})
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	var sleeps []time.Duration
+	f := testFetcher(&sleeps)
+	f.Timeout = 10 * time.Millisecond
+	f.Retries = 1
+	_, err := f.Fetch(context.Background(), ts.URL)
+	require.Error(t, err)
+	require.Equal(t, 1, len(sleeps))
+}
+
+func TestScrapeNotModified(t *testing.T) {
+	const etag = `"rev-1"`
+	var fullResponses int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&fullResponses, 1)
+		reader, err := os.Open(filepath.Join("testdata", wikiFile))
+		require.NoError(t, err)
+		defer reader.Close()
+		w.Header().Set("ETag", etag)
+		_, err = io.Copy(w, reader)
+		require.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	s := wikiScraper()
+	s.URL = ts.URL
+	s.Fetcher = NewFetcher()
+	table, _, err := s.Scrape()
+	require.NoError(t, err)
+	require.NotEmpty(t, table.Cells)
+
+	_, _, err = s.Scrape()
+	require.True(t, errors.Is(err, ErrNotModified))
+	require.Equal(t, int32(1), fullResponses)
+
+	s.Forget()
+	_, _, err = s.Scrape()
+	require.NoError(t, err)
+	require.Equal(t, int32(2), fullResponses)
+
+	s.Fetcher.Conditional = false
+	_, _, err = s.Scrape()
+	require.NoError(t, err)
+	require.Equal(t, int32(3), fullResponses)
+}
+
+func TestScrapeNotModifiedSharedURL(t *testing.T) {
+	const etag = `"rev-1"`
+	var fullResponses int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&fullResponses, 1)
+		w.Header().Set("ETag", etag)
+		http.ServeFile(w, r, filepath.Join("testdata", wikiFile))
+	}))
+	defer ts.Close()
+
+	fetcher := NewFetcher()
+	s1, s2 := wikiScraper(), wikiScraper()
+	s1.URL, s2.URL = ts.URL, ts.URL
+	s1.Fetcher, s2.Fetcher = fetcher, fetcher
+	s2.TargetTableName = "entries_copy"
+
+	for _, s := range []*Scraper{s1, s2} {
+		table, _, err := s.Scrape()
+		require.NoError(t, err)
+		require.NotEmpty(t, table.Cells)
+	}
+	require.Equal(t, int32(2), fullResponses)
+
+	for _, s := range []*Scraper{s1, s2} {
+		_, _, err := s.Scrape()
+		require.True(t, errors.Is(err, ErrNotModified))
+	}
+	require.Equal(t, int32(2), fullResponses)
+}
+
+func TestScrapeNotRememberedOnErr(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Empty(t, r.Header.Get("If-Modified-Since"))
+		w.Header().Set("Last-Modified", "Sun, 05 Apr 2020 17:03:01 GMT")
+		_, _ = io.WriteString(w, "<p>Service temporarily unavailable</p>")
+	}))
+	defer ts.Close()
+
+	s := wikiScraper()
+	s.URL = ts.URL
+	s.Fetcher = NewFetcher()
+	for i := 0; i < 2; i++ {
+		_, _, err := s.Scrape()
+		require.Error(t, err)
+		require.False(t, errors.Is(err, ErrNotModified))
+	}
+}
+
+func TestScrapeContextCancelled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	s := wikiScraper()
+	s.URL = ts.URL
+	s.Fetcher = NewFetcher()
+	s.Fetcher.MinBackoff = time.Hour
+	s.Fetcher.MaxBackoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := s.ScrapeContext(ctx)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	require.True(t, time.Since(start) < time.Minute)
+}
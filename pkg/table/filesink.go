@@ -0,0 +1,159 @@
+package table
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// CSVSink writes each table to <dir>/<table name>.csv with a header row.
+type CSVSink struct {
+	dir string
+}
+
+func NewCSVSink(dir string) (*CSVSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &CSVSink{dir: dir}, nil
+}
+
+func (c *CSVSink) filename(t *Table) string {
+	return filepath.Join(c.dir, t.Name+".csv")
+}
+
+func (c *CSVSink) SetupSchema(ctx context.Context, t *Table) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := validateAppendOnly(t); err != nil {
+		return err
+	}
+	header := append([]string{"date"}, t.GetColumnNames()...)
+	f, err := os.Open(c.filename(t))
+	if os.IsNotExist(err) {
+		return c.writeRecords(t, [][]string{header})
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	got, err := csv.NewReader(f).Read()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if !reflect.DeepEqual(header, got) {
+		return fmt.Errorf("expected csv header %v, got %v", header, got)
+	}
+	return nil
+}
+
+func (c *CSVSink) Write(ctx context.Context, t *Table) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	date := t.date().Format(time.RFC3339)
+	records := make([][]string, len(t.Cells))
+	for i, row := range t.Cells {
+		record := make([]string, len(row)+1)
+		record[0] = date
+		for j, v := range row {
+			record[j+1] = formatValue(t.Columns[j].Type, v)
+		}
+		records[i] = record
+	}
+	return c.writeRecords(t, records)
+}
+
+func (c *CSVSink) writeRecords(t *Table, records [][]string) error {
+	f, err := os.OpenFile(c.filename(t), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(records); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (c *CSVSink) Close() error {
+	return nil
+}
+
+// JSONLSink writes each table to <dir>/<table name>.jsonl with one JSON
+// object per row.
+type JSONLSink struct {
+	dir string
+}
+
+func NewJSONLSink(dir string) (*JSONLSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &JSONLSink{dir: dir}, nil
+}
+
+func (j *JSONLSink) SetupSchema(ctx context.Context, t *Table) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return validateAppendOnly(t)
+}
+
+func (j *JSONLSink) Write(ctx context.Context, t *Table) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(j.dir, t.Name+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	date := t.date()
+	colNames := t.GetColumnNames()
+	for _, row := range t.Cells {
+		obj := make(map[string]interface{}, len(row)+1)
+		obj["date"] = date
+		for i, v := range row {
+			if _, ok := v.(time.Time); ok {
+				v = formatValue(t.Columns[i].Type, v)
+			}
+			obj[colNames[i]] = v
+		}
+		if err := enc.Encode(obj); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (j *JSONLSink) Close() error {
+	return nil
+}
+
+// validateAppendOnly checks that t can be written to a file sink, which
+// only appends rows.
+func validateAppendOnly(t *Table) error {
+	if !identifierRe.MatchString(t.Name) {
+		return fmt.Errorf("invalid table name, must be SQL identifier")
+	}
+	if len(t.Key) != 0 || t.SkipUnchanged {
+		return fmt.Errorf("natural key and skip unchanged not supported by file sinks")
+	}
+	return nil
+}
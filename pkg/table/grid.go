@@ -0,0 +1,152 @@
+package table
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/juliaogris/covid19/pkg/htmlx"
+	"golang.org/x/net/html"
+)
+
+type cell struct {
+	text    string
+	header  bool // th rather than td
+	spanned bool // copied from a cell with rowspan or colspan
+	missing bool // placeholder for an optional column not in the table
+
+	node *html.Node // th or td element, nil for missing cells
+}
+
+// CellKind restricts a column to header (th) or data (td) cells.
+type CellKind string
+
+const (
+	AnyCell    CellKind = ""
+	HeaderCell CellKind = "header"
+	DataCell   CellKind = "data"
+)
+
+func (c cell) kind() CellKind {
+	if c.header {
+		return HeaderCell
+	}
+	return DataCell
+}
+
+// spanned keeps track of a cell with rowspan for the rows below it.
+type spanned struct {
+	cell
+	rows int
+}
+
+const (
+	maxColSpan = 1000
+	maxRowSpan = 65534
+)
+
+// getRows returns the table rows as rectangular grid. Cells spanning
+// multiple rows or columns are repeated in every position they cover.
+// Rows too short to reach a cell spanning down into them are padded with
+// empty cells.
+func getRows(table *html.Node) [][]cell {
+	trs := htmlx.QueryAllNoChildren(table, &htmlx.Selector{Tag: "tr"})
+	rows := make([][]cell, len(trs))
+	var spans []spanned
+	for i, tr := range trs {
+		rows[i], spans = getRow(tr, spans, len(trs)-i)
+	}
+	return rows
+}
+
+func getRow(tr *html.Node, spans []spanned, remainingRows int) ([]cell, []spanned) {
+	var row []cell
+	col := 0
+	fillSpans := func() {
+		for col < len(spans) && spans[col].rows > 0 {
+			row = append(row, spans[col].cell)
+			spans[col].rows--
+			col++
+		}
+	}
+	for n := tr.FirstChild; n != nil; n = n.NextSibling {
+		if n.Type != html.ElementNode || (n.Data != "th" && n.Data != "td") {
+			continue
+		}
+		fillSpans()
+		c := cell{text: strings.TrimSpace(getText(n)), header: n.Data == "th", node: n}
+		rowSpan := getSpan(n, "rowspan", maxRowSpan)
+		if rowSpan == 0 {
+			rowSpan = remainingRows
+		}
+		for i := getSpan(n, "colspan", maxColSpan); i > 0; i-- {
+			row = append(row, c)
+			for col >= len(spans) {
+				spans = append(spans, spanned{})
+			}
+			spans[col] = spanned{cell: cell{text: c.text, header: c.header, spanned: true, node: n}, rows: rowSpan - 1}
+			col++
+			c.spanned = true
+		}
+	}
+	fillSpans()
+	// pad short rows up to the last cell spanning down from rows above,
+	// so that it stays in its column
+	last := -1
+	for i := col; i < len(spans); i++ {
+		if spans[i].rows > 0 {
+			last = i
+		}
+	}
+	for ; col <= last; col++ {
+		if spans[col].rows > 0 {
+			row = append(row, spans[col].cell)
+			spans[col].rows--
+		} else {
+			row = append(row, cell{})
+		}
+	}
+	return row, spans
+}
+
+func getSpan(n *html.Node, key string, max int) int {
+	for _, a := range n.Attr {
+		if a.Key != key {
+			continue
+		}
+		span, err := strconv.Atoi(strings.TrimSpace(a.Val))
+		if err != nil || span < 0 {
+			return 1
+		}
+		if span > max {
+			return max
+		}
+		if span == 0 && key == "colspan" {
+			return 1
+		}
+		return span
+	}
+	return 1
+}
+
+// getTexts returns the cells of a row that are not copies of spanning
+// cells, i.e. the row as it appears in the HTML source.
+func getTexts(row []cell) []string {
+	texts := make([]string, 0, len(row))
+	for _, c := range row {
+		if !c.spanned {
+			texts = append(texts, c.text)
+		}
+	}
+	return texts
+}
+
+func getText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return strings.Trim(n.Data, "\n")
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(getText(c))
+	}
+	return sb.String()
+}
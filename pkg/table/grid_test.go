@@ -0,0 +1,133 @@
+package table
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+const spanTable = `<table>
+<tr><th colspan="2">Location</th><th>Cases</th><th>Deaths</th></tr>
+<tr><td rowspan="2">US</td><td>New York</td><td>1,000</td><td rowspan="3">10</td></tr>
+<tr><td>New Jersey</td><td>500</td></tr>
+<tr><td>Italy</td><td colspan="2">200</td></tr>
+</table>`
+
+func parseTableFixture(t *testing.T, s string) *html.Node {
+	t.Helper()
+	n, err := html.Parse(strings.NewReader(s))
+	require.NoError(t, err)
+	return n
+}
+
+const shortRowTable = `<table>
+<tr><td>a</td><td>b</td><td rowspan="3">C</td></tr>
+<tr><td>x</td></tr>
+<tr><td>y</td><td>z</td></tr>
+<tr><td>p</td><td>q</td><td>r</td></tr>
+</table>`
+
+func TestGetRows(t *testing.T) {
+	tests := map[string]struct {
+		table       string
+		want        [][]string
+		wantSpanned [][]bool
+	}{
+		"spans": {
+			table: spanTable,
+			want: [][]string{
+				{"Location", "Location", "Cases", "Deaths"},
+				{"US", "New York", "1,000", "10"},
+				{"US", "New Jersey", "500", "10"},
+				{"Italy", "200", "200", "10"},
+			},
+			wantSpanned: [][]bool{
+				{false, true, false, false},
+				{false, false, false, false},
+				{true, false, false, true},
+				{false, false, true, true},
+			},
+		},
+		"short_row": {
+			table: shortRowTable,
+			want: [][]string{
+				{"a", "b", "C"},
+				{"x", "", "C"},
+				{"y", "z", "C"},
+				{"p", "q", "r"},
+			},
+			wantSpanned: [][]bool{
+				{false, false, false},
+				{false, false, true},
+				{false, false, true},
+				{false, false, false},
+			},
+		},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			rows := getRows(parseTableFixture(t, tc.table))
+			require.Equal(t, len(tc.want), len(rows))
+			for i, row := range rows {
+				texts := make([]string, len(row))
+				spanned := make([]bool, len(row))
+				for j, c := range row {
+					texts[j] = c.text
+					spanned[j] = c.spanned
+				}
+				require.Equal(t, tc.want[i], texts)
+				require.Equal(t, tc.wantSpanned[i], spanned)
+			}
+		})
+	}
+	rows := getRows(parseTableFixture(t, spanTable))
+	require.Equal(t, []string{"Location", "Cases", "Deaths"}, getTexts(rows[0]))
+}
+
+func TestParseSpannedRows(t *testing.T) {
+	rows := getRows(parseTableFixture(t, spanTable))
+	colDefs := []ColumnDef{
+		{TargetName: "country", Type: StringType},
+		{TargetName: "region", Type: StringType},
+		{TargetName: "cases", Type: IntType},
+		{TargetName: "deaths", Type: IntType, BlankSpanned: true},
+	}
+	table, _, err := parseTableBody(rows[1:], colDefs, false)
+	require.NoError(t, err)
+	want := [][]interface{}{
+		{"US", "New York", 1000, 10},
+		{"US", "New Jersey", 500, 0},
+		{"Italy", "200", 200, 0},
+	}
+	require.Equal(t, want, table.Cells)
+}
+
+func TestGetRowsDocumentOrder(t *testing.T) {
+	rows := getRows(parseTableFixture(t, `<table>
+<tr><td>1</td><th>Italy</th><td>200</td><th>[a]</th></tr>
+</table>`))
+	require.Equal(t, 1, len(rows))
+	require.Equal(t, []string{"1", "Italy", "200", "[a]"}, getTexts(rows[0]))
+	kinds := make([]CellKind, len(rows[0]))
+	for i, c := range rows[0] {
+		kinds[i] = c.kind()
+	}
+	require.Equal(t, []CellKind{DataCell, HeaderCell, DataCell, HeaderCell}, kinds)
+
+	colDefs := []ColumnDef{
+		{Skip: true},
+		{TargetName: "country", Type: StringType, Kind: HeaderCell},
+		{TargetName: "cases", Type: IntType, Kind: DataCell},
+		{Skip: true},
+	}
+	got, err := parseRow(rows[0], colDefs)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"Italy", 200}, got)
+
+	colDefs[2].Kind = HeaderCell
+	_, err = parseRow(rows[0], colDefs)
+	require.Error(t, err)
+}
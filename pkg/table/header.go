@@ -0,0 +1,93 @@
+package table
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// getHeaderParts returns the distinct texts of every column of the header
+// rows from top to bottom. Cells spanning several columns or rows are part
+// of every column or row they cover, e.g. "Cases" with colspan 2 above
+// "Total" and "New" gives [Cases Total] and [Cases New].
+func getHeaderParts(headerRows [][]cell) [][]string {
+	var width int
+	for _, row := range headerRows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	parts := make([][]string, width)
+	for i := range parts {
+		for _, row := range headerRows {
+			if i < len(row) && row[i].text != "" && (len(parts[i]) == 0 || parts[i][len(parts[i])-1] != row[i].text) {
+				parts[i] = append(parts[i], row[i].text)
+			}
+		}
+	}
+	return parts
+}
+
+// getHeaderTexts returns the text of every column of the header rows,
+// joining the parts of grouped headers with a space.
+func getHeaderTexts(headerRows [][]cell) []string {
+	parts := getHeaderParts(headerRows)
+	texts := make([]string, len(parts))
+	for i, p := range parts {
+		texts[i] = strings.Join(p, " ")
+	}
+	return texts
+}
+
+var footnoteRe = regexp.MustCompile(`\[[^\]]*\]`)
+
+// flattenHeader returns a column name for every column of the header rows,
+// e.g. "cases_total" and "cases_new" for "Cases" spanning "Total" and "New".
+// Names are made unique with a numeric suffix, empty headers are named
+// after their position, e.g. "column_3".
+func flattenHeader(headerRows [][]cell) []string {
+	parts := getHeaderParts(headerRows)
+	names := make([]string, len(parts))
+	seen := map[string]int{}
+	for i, p := range parts {
+		name := headerName(p)
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		if seen[name]++; seen[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, seen[name])
+		}
+		names[i] = name
+	}
+	return names
+}
+
+// headerName joins header texts into a lower case name of letters, digits
+// and underscores, dropping footnotes such as "[a]".
+func headerName(parts []string) string {
+	var words []string
+	for _, p := range parts {
+		p = footnoteRe.ReplaceAllString(strings.ToLower(p), " ")
+		words = append(words, strings.FieldsFunc(p, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})...)
+	}
+	return strings.Join(words, "_")
+}
+
+// withDefaultTargetNames returns a copy of colDefs where empty TargetNames
+// are set to the flattened header name of their column.
+func withDefaultTargetNames(colDefs []ColumnDef, names []string) ([]ColumnDef, error) {
+	result := append([]ColumnDef(nil), colDefs...)
+	for i := range result {
+		if result[i].Skip || result[i].TargetName != "" {
+			continue
+		}
+		if i >= len(names) {
+			return nil, fmt.Errorf("column %d: no header for default target name", i)
+		}
+		result[i].TargetName = names[i]
+	}
+	return result, nil
+}
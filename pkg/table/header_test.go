@@ -0,0 +1,55 @@
+package table
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestFlattenHeader(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<table>
+<tr><th rowspan="2">Country<sup>[a]</sup></th><th colspan="3">Cases</th><th rowspan="2"></th><th rowspan="2">Deaths</th><th colspan="2">Deaths</th></tr>
+<tr><th>Total</th><th>New</th><th>Per&nbsp;million</th><th>New</th><th>New</th></tr>
+</table>`))
+	require.NoError(t, err)
+	rows := getRows(doc)
+	want := []string{"country", "cases_total", "cases_new", "cases_per_million", "column_5", "deaths", "deaths_new", "deaths_new_2"}
+	require.Equal(t, want, flattenHeader(rows))
+	require.Equal(t, "Cases Per million", getHeaderTexts(rows)[3])
+}
+
+func TestFlattenHeaderScrape(t *testing.T) {
+	s := &Scraper{
+		CSSSelector: "table",
+		ColumnDefs: []ColumnDef{
+			{Type: StringType},
+			{Type: IntType},
+			{TargetName: "new", Type: IntType},
+			{Skip: true},
+			{Type: IntType},
+		},
+		HeaderColNames: []string{"country", "cases_total", "cases_new", "tests", "deaths"},
+		HeaderRowCount: 2,
+		FlattenHeader:  true,
+		KeyColNames:    []string{"country"},
+	}
+	require.NoError(t, ValidateScraper(s))
+	table, _, err := s.scrapeFromReader(strings.NewReader(insertedColumnDoc))
+	require.NoError(t, err)
+	require.Equal(t, []string{"country", "cases_total", "new", "deaths"}, table.GetColumnNames())
+	require.Equal(t, []interface{}{"Italy", 1000, 10, 100}, table.Cells[0])
+	require.Equal(t, "", s.ColumnDefs[0].TargetName)
+
+	s.HeaderColNames[1] = "cases_new"
+	_, _, err = s.scrapeFromReader(strings.NewReader(insertedColumnDoc))
+	require.Error(t, err)
+
+	s.FlattenHeader = false
+	require.Error(t, ValidateScraper(s))
+
+	s.FlattenHeader = true
+	s.HeaderRowCount = 0
+	require.Error(t, ValidateScraper(s))
+}
@@ -0,0 +1,191 @@
+package table
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrUnchanged is returned by Sink.Write for tables with SkipUnchanged set
+// if the rows equal the last written snapshot; nothing is written then.
+var ErrUnchanged = errors.New("unchanged since last snapshot")
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Queries returning the definition of an index by table and index name,
+// which ends in the parenthesised list of indexed columns.
+const (
+	pqIndexDefQuery     = "SELECT indexdef FROM pg_indexes WHERE tablename = lower($1) AND indexname = lower($2)"
+	sqliteIndexDefQuery = "SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? COLLATE NOCASE AND name = ? COLLATE NOCASE"
+)
+
+var indexColsRe = regexp.MustCompile(`\(([^()]*)\)\s*$`)
+
+func validateKey(t *Table) error {
+	colNames := append([]string{"date"}, t.GetColumnNames()...)
+	for _, k := range t.Key {
+		if index(colNames, k) == -1 {
+			return fmt.Errorf("unknown key column '%s'", k)
+		}
+	}
+	return nil
+}
+
+// createKeyIndex creates the unique index on the natural key columns
+// required for upserts with ON CONFLICT. An existing index for a
+// different key is an error, as upserts would fail against it.
+func createKeyIndex(ctx context.Context, db execer, t *Table, indexDefQuery string) error {
+	if err := validateKey(t); err != nil {
+		return err
+	}
+	name := t.Name + "_key"
+	var def string
+	err := db.QueryRowContext(ctx, indexDefQuery, t.Name, name).Scan(&def)
+	if err == nil {
+		return checkKeyIndex(name, def, t.Key)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	if len(t.Key) == 0 {
+		return nil
+	}
+	stmt := fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", name, t.Name, strings.Join(t.Key, ", "))
+	_, err = db.ExecContext(ctx, stmt)
+	return err
+}
+
+// checkKeyIndex checks that the index with definition def is on the key
+// columns.
+func checkKeyIndex(name, def string, key []string) error {
+	m := indexColsRe.FindStringSubmatch(def)
+	if m == nil {
+		return fmt.Errorf("cannot parse definition of index %s: %s", name, def)
+	}
+	cols := strings.Split(m[1], ",")
+	for i, col := range cols {
+		cols[i] = strings.ToLower(strings.Trim(col, ` "`))
+	}
+	got := strings.Join(cols, ", ")
+	want := strings.ToLower(strings.Join(key, ", "))
+	if got != want {
+		return fmt.Errorf("unique index %s is on (%s), not on key (%s); drop the index to change the key", name, got, want)
+	}
+	return nil
+}
+
+// checkUniqueKey returns an error if rows of t share a natural key, which
+// a single upsert cannot write.
+func checkUniqueKey(t *Table) error {
+	if len(t.Key) == 0 {
+		return nil
+	}
+	colNames := t.GetColumnNames()
+	seen := make(map[string]bool, len(t.Cells))
+	for _, row := range t.Cells {
+		var vals []interface{}
+		for _, k := range t.Key {
+			if k != "date" { // same for all rows
+				vals = append(vals, row[index(colNames, k)])
+			}
+		}
+		key := rowKey(vals)
+		if seen[key] {
+			return fmt.Errorf("duplicate key (%s) = (%s)", strings.Join(t.Key, ", "), strings.ReplaceAll(key, "\x1f", ", "))
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// getUpsertStmt returns the statement copying all rows from the staging
+// table into the target table, updating rows with existing natural keys.
+func getUpsertStmt(t *Table, staging string) string {
+	cols := strings.Join(getInsertColNames(t), ", ")
+	return fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s%s", t.Name, cols, cols, staging, getOnConflict(t))
+}
+
+func getOnConflict(t *Table) string {
+	var set []string
+	for _, col := range getInsertColNames(t) {
+		if index(t.Key, col) == -1 {
+			set = append(set, fmt.Sprintf("%s = EXCLUDED.%s", col, col))
+		}
+	}
+	return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(t.Key, ", "), strings.Join(set, ", "))
+}
+
+// getInsertColNames returns the column names written by SQL sinks.
+func getInsertColNames(t *Table) []string {
+	return append([]string{"date", "run_id"}, t.GetColumnNames()...)
+}
+
+// isUnchangedSnapshot reports whether the rows of t equal the rows
+// written by the last scrape run, ignoring row order. Runs rather than
+// dates identify snapshots, as several runs may share an as-of date.
+func isUnchangedSnapshot(ctx context.Context, txn *sql.Tx, t *Table) (bool, error) {
+	cols := strings.Join(t.GetColumnNames(), ", ")
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE run_id = (SELECT max(run_id) FROM %s)", cols, t.Name, t.Name)
+	rows, err := txn.QueryContext(ctx, q)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var last []string
+	for rows.Next() {
+		vals := make([]interface{}, len(t.Columns))
+		ptrs := make([]interface{}, len(vals))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return false, err
+		}
+		last = append(last, rowKey(vals))
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	return equalSnapshots(last, t.Cells), nil
+}
+
+func equalSnapshots(last []string, cells [][]interface{}) bool {
+	if len(last) != len(cells) {
+		return false
+	}
+	current := make([]string, len(cells))
+	for i, row := range cells {
+		current[i] = rowKey(row)
+	}
+	sort.Strings(last)
+	sort.Strings(current)
+	for i := range last {
+		if last[i] != current[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func rowKey(row []interface{}) string {
+	s := make([]string, len(row))
+	for i, v := range row {
+		switch val := v.(type) {
+		case []byte:
+			v = string(val)
+		case time.Time:
+			v = val.UTC().Format(time.RFC3339Nano)
+		}
+		s[i] = fmt.Sprint(v)
+	}
+	return strings.Join(s, "\x1f")
+}
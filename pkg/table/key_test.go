@@ -0,0 +1,143 @@
+package table
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpsertStmt(t *testing.T) {
+	table := sinkTableFixture()
+	table.Key = []string{"country"}
+	want := "INSERT INTO entries (date, run_id, country, cases, rate) SELECT date, run_id, country, cases, rate FROM staging" +
+		" ON CONFLICT (country) DO UPDATE SET date = EXCLUDED.date, run_id = EXCLUDED.run_id, cases = EXCLUDED.cases, rate = EXCLUDED.rate"
+	require.Equal(t, want, getUpsertStmt(table, "staging"))
+
+	table.Key = []string{"date", "country", "cases", "rate"}
+	require.Equal(t, " ON CONFLICT (date, country, cases, rate) DO UPDATE SET run_id = EXCLUDED.run_id", getOnConflict(table))
+}
+
+func TestEqualSnapshots(t *testing.T) {
+	cells := sinkTableFixture().Cells
+	last := []string{rowKey(cells[1]), rowKey(cells[0])}
+	require.True(t, equalSnapshots(last, cells))
+	require.False(t, equalSnapshots(last[:1], cells))
+	require.False(t, equalSnapshots(last, [][]interface{}{cells[0], cells[0]}))
+	require.Equal(t, rowKey([]interface{}{"Italy", int64(200)}), rowKey([]interface{}{[]byte("Italy"), 200}))
+}
+
+func TestSinkKey(t *testing.T) {
+	sqlite, err := OpenSQLiteSink(filepath.Join(tempDir(t), "covid.db"))
+	require.NoError(t, err)
+	defer sqlite.Close()
+	mem := NewMemSink()
+
+	tests := map[string]struct {
+		sink     Sink
+		rowCount func() int
+	}{
+		"sqlite": {sink: sqlite, rowCount: func() int {
+			var cnt int
+			require.NoError(t, sqlite.db.QueryRow("SELECT count(*) FROM entries").Scan(&cnt))
+			return cnt
+		}},
+		"mem": {sink: mem, rowCount: func() int {
+			return len(mem.Table("entries").Cells)
+		}},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			table := sinkTableFixture()
+			table.Key = []string{"country"}
+			require.NoError(t, PersistTo(tc.sink, table))
+			require.NoError(t, PersistTo(tc.sink, table))
+			require.Equal(t, 2, tc.rowCount())
+
+			table.SkipUnchanged = true
+			require.Equal(t, ErrUnchanged, PersistTo(tc.sink, table))
+
+			table.Cells = append(table.Cells, []interface{}{"France", 50, 0.5})
+			require.NoError(t, PersistTo(tc.sink, table))
+			require.Equal(t, 3, tc.rowCount())
+		})
+	}
+}
+
+func TestSinkUnchangedSameAsOf(t *testing.T) {
+	sqlite, err := OpenSQLiteSink(filepath.Join(tempDir(t), "covid.db"))
+	require.NoError(t, err)
+	defer sqlite.Close()
+	sinks := map[string]Sink{"sqlite": sqlite, "mem": NewMemSink()}
+	for name, sink := range sinks {
+		sink := sink
+		t.Run(name, func(t *testing.T) {
+			table := sinkTableFixture()
+			table.AsOf = time.Date(2020, 4, 5, 0, 0, 0, 0, time.UTC)
+			table.SkipUnchanged = true
+			require.NoError(t, PersistTo(sink, table))
+
+			table.Cells = [][]interface{}{{"Italy", 300, 1.5}}
+			require.NoError(t, PersistTo(sink, table))
+			require.Equal(t, ErrUnchanged, PersistTo(sink, table))
+			require.Equal(t, ErrUnchanged, PersistTo(sink, table))
+
+			table.Cells = sinkTableFixture().Cells
+			require.NoError(t, PersistTo(sink, table))
+		})
+	}
+}
+
+func TestFileSinkKeyErr(t *testing.T) {
+	table := sinkTableFixture()
+	table.Key = []string{"country"}
+	csvSink, err := NewCSVSink(tempDir(t))
+	require.NoError(t, err)
+	require.Error(t, csvSink.SetupSchema(context.Background(), table))
+	jsonlSink, err := NewJSONLSink(tempDir(t))
+	require.NoError(t, err)
+	require.Error(t, jsonlSink.SetupSchema(context.Background(), table))
+
+	table.Key = []string{"deaths"}
+	require.Error(t, NewMemSink().SetupSchema(context.Background(), table))
+}
+
+func TestCheckKeyIndex(t *testing.T) {
+	def := `CREATE UNIQUE INDEX entries_key ON public.entries USING btree ("date", country)`
+	require.NoError(t, checkKeyIndex("entries_key", def, []string{"date", "country"}))
+	require.Error(t, checkKeyIndex("entries_key", def, []string{"country"}))
+	require.Error(t, checkKeyIndex("entries_key", def, nil))
+	require.Error(t, checkKeyIndex("entries_key", "CREATE INDEX", []string{"country"}))
+}
+
+func TestSQLiteSinkKeyChanged(t *testing.T) {
+	sink, err := OpenSQLiteSink(filepath.Join(tempDir(t), "covid.db"))
+	require.NoError(t, err)
+	defer sink.Close()
+	table := sinkTableFixture()
+	table.Key = []string{"country"}
+	require.NoError(t, PersistTo(sink, table))
+	require.NoError(t, PersistTo(sink, table))
+
+	table.Key = []string{"country", "cases"}
+	require.Error(t, PersistTo(sink, table))
+	table.Key = nil
+	require.Error(t, PersistTo(sink, table))
+}
+
+func TestSinkDuplicateKey(t *testing.T) {
+	sink, err := OpenSQLiteSink(filepath.Join(tempDir(t), "covid.db"))
+	require.NoError(t, err)
+	defer sink.Close()
+	table := sinkTableFixture()
+	table.Key = []string{"date", "country"}
+	table.Cells = append(table.Cells, []interface{}{"Italy", 300, 2.5})
+	err = PersistTo(sink, table)
+	require.EqualError(t, err, "duplicate key (date, country) = (Italy)")
+
+	table.Key = []string{"country", "cases"}
+	require.NoError(t, checkUniqueKey(table))
+}
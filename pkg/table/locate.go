@@ -0,0 +1,78 @@
+package table
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juliaogris/covid19/pkg/htmlx"
+	"golang.org/x/net/html"
+)
+
+// tableCandidate is a table considered by locateTable.
+type tableCandidate struct {
+	node    *html.Node
+	index   int // position among all tables of the document
+	caption string
+	header  []string
+	score   int // number of HeaderColNames matched by header
+}
+
+func (c tableCandidate) String() string {
+	return fmt.Sprintf("table %d (caption %q, header %q)", c.index, c.caption, strings.Join(c.header, " | "))
+}
+
+// locateTable returns the table whose caption contains Scraper.Caption
+// and whose header row best matches HeaderColNames. It fails if several
+// tables match equally well.
+func (s *Scraper) locateTable(n *html.Node) (*html.Node, error) {
+	tables := htmlx.QueryAll(n, &htmlx.Selector{Tag: "table"})
+	var best []tableCandidate
+	for i, table := range tables {
+		c := s.newTableCandidate(table, i)
+		if s.Caption != "" && !headerMatches(c.caption, s.Caption) {
+			continue
+		}
+		if len(s.HeaderColNames) > 0 && c.score == 0 {
+			continue
+		}
+		if len(best) > 0 && c.score < best[0].score {
+			continue
+		}
+		if len(best) > 0 && c.score > best[0].score {
+			best = best[:0]
+		}
+		best = append(best, c)
+	}
+	switch len(best) {
+	case 0:
+		return nil, fmt.Errorf("no table with caption '%s' and header %q among %d tables", s.Caption, s.HeaderColNames, len(tables))
+	case 1:
+		return best[0].node, nil
+	}
+	candidates := make([]string, len(best))
+	for i, c := range best {
+		candidates[i] = c.String()
+	}
+	return nil, fmt.Errorf("ambiguous table, %d candidates match equally:\n%s", len(best), strings.Join(candidates, "\n"))
+}
+
+func (s *Scraper) newTableCandidate(table *html.Node, index int) tableCandidate {
+	c := tableCandidate{node: table, index: index}
+	for n := table.FirstChild; n != nil; n = n.NextSibling {
+		if n.Type == html.ElementNode && n.Data == "caption" {
+			c.caption = strings.Join(strings.Fields(getText(n)), " ")
+			break
+		}
+	}
+	rows := getRows(table)
+	if s.HeaderRowIndex >= len(rows) {
+		return c
+	}
+	c.header = getTexts(rows[s.HeaderRowIndex])
+	for i, colName := range s.HeaderColNames {
+		if i < len(c.header) && headerMatches(c.header[i], colName) {
+			c.score++
+		}
+	}
+	return c
+}
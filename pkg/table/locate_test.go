@@ -0,0 +1,100 @@
+package table
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+const locateDoc = `<html><body>
+<table id="legend"><tr><th>Key</th><th>Meaning</th></tr><tr><td>a</td><td>b</td></tr></table>
+<table id="daily"><caption>Daily cases</caption>
+  <tr><th>Country</th><th>Cases</th></tr><tr><td>Italy</td><td>1</td></tr></table>
+<table id="total"><caption>Total cases <sup>[1]</sup></caption>
+  <tr><th>Country</th><th>Cases</th></tr><tr><td>Italy</td><td>10</td></tr></table>
+<table id="partial"><tr><th>Country</th><th>Notes</th></tr></table>
+</body></html>`
+
+func locateScraper() *Scraper {
+	return &Scraper{
+		ColumnDefs: []ColumnDef{
+			{TargetName: "country", Type: StringType},
+			{TargetName: "cases", Type: IntType},
+		},
+		HeaderColNames: []string{"country", "cases"},
+		HeaderRowCount: 1,
+	}
+}
+
+func TestLocateTable(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(locateDoc))
+	require.NoError(t, err)
+
+	s := locateScraper()
+	s.Caption = "total cases"
+	require.NoError(t, ValidateScraper(s))
+	table, err := s.locateTable(doc)
+	require.NoError(t, err)
+	require.Equal(t, "total", getID(table))
+
+	s.Caption = ""
+	s.HeaderColNames = []string{"country", "notes"}
+	table, err = s.locateTable(doc)
+	require.NoError(t, err)
+	require.Equal(t, "partial", getID(table))
+
+	s.HeaderColNames = nil
+	s.Caption = "Daily"
+	table, err = s.locateTable(doc)
+	require.NoError(t, err)
+	require.Equal(t, "daily", getID(table))
+}
+
+func TestLocateTableErr(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(locateDoc))
+	require.NoError(t, err)
+
+	s := locateScraper()
+	require.NoError(t, ValidateScraper(s))
+	_, err = s.locateTable(doc)
+	require.Error(t, err)
+	want := `ambiguous table, 2 candidates match equally:
+table 1 (caption "Daily cases", header "Country | Cases")
+table 2 (caption "Total cases [1]", header "Country | Cases")`
+	require.Equal(t, want, err.Error())
+
+	s.Caption = "weekly"
+	_, err = s.locateTable(doc)
+	require.Error(t, err)
+
+	s.Caption = ""
+	s.HeaderColNames = nil
+	require.Error(t, ValidateScraper(s))
+}
+
+func TestLocateWikiTable(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", wikiFile))
+	require.NoError(t, err)
+	defer r.Close()
+
+	s := wikiScraper()
+	s.CSSSelector = ""
+	require.NoError(t, ValidateScraper(s))
+	table, _, err := s.scrapeFromReader(r)
+	require.NoError(t, err)
+	require.Equal(t, 223, len(table.Cells))
+	require.Equal(t, []interface{}{"United States", 311616, 8489, 14943}, table.Cells[0])
+}
+
+func getID(n *html.Node) string {
+	for _, a := range n.Attr {
+		if a.Key == "id" {
+			return a.Val
+		}
+	}
+	return ""
+}
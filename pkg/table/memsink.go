@@ -0,0 +1,164 @@
+package table
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// MemSink keeps tables in memory, mostly for testing.
+type MemSink struct {
+	mu     sync.Mutex
+	tables map[string]*memTable
+	runs   []Run
+}
+
+type memTable struct {
+	*Table
+	dates  []time.Time // date column for each row in Cells
+	runIDs []int64     // run_id column for each row in Cells
+}
+
+var (
+	memSinksMu sync.Mutex
+	memSinks   = map[string]*MemSink{}
+)
+
+func NewMemSink() *MemSink {
+	return &MemSink{tables: map[string]*memTable{}}
+}
+
+// GetMemSink returns the MemSink for a given name, as used by the
+// mem://name connection string, creating it if necessary.
+func GetMemSink(name string) *MemSink {
+	memSinksMu.Lock()
+	defer memSinksMu.Unlock()
+	m, ok := memSinks[name]
+	if !ok {
+		m = NewMemSink()
+		memSinks[name] = m
+	}
+	return m
+}
+
+func (m *MemSink) SetupSchema(ctx context.Context, t *Table) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mt, ok := m.tables[t.Name]; ok {
+		if !reflect.DeepEqual(mt.Columns, t.Columns) {
+			return fmt.Errorf("expected columns %v, got %v", mt.Columns, t.Columns)
+		}
+		return nil
+	}
+	if err := validateKey(t); err != nil {
+		return err
+	}
+	columns := append([]Column(nil), t.Columns...)
+	m.tables[t.Name] = &memTable{Table: &Table{Name: t.Name, Columns: columns}}
+	return nil
+}
+
+func (m *MemSink) Write(ctx context.Context, t *Table) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mt, ok := m.tables[t.Name]
+	if !ok {
+		return fmt.Errorf("unknown table '%s'", t.Name)
+	}
+	if t.SkipUnchanged && equalSnapshots(mt.lastSnapshot(), t.Cells) {
+		return ErrUnchanged
+	}
+	run := getRun(t)
+	run.ID = int64(len(m.runs) + 1)
+	m.runs = append(m.runs, *run)
+	date := t.date()
+	for _, row := range t.Cells {
+		row = append([]interface{}(nil), row...)
+		if i := mt.index(t.Key, row, date); i != -1 {
+			mt.Cells[i] = row
+			mt.dates[i] = date
+			mt.runIDs[i] = run.ID
+			continue
+		}
+		mt.Cells = append(mt.Cells, row)
+		mt.dates = append(mt.dates, date)
+		mt.runIDs = append(mt.runIDs, run.ID)
+	}
+	return nil
+}
+
+// lastSnapshot returns the row keys of the rows written by the last run.
+func (mt *memTable) lastSnapshot() []string {
+	var last int64
+	for _, id := range mt.runIDs {
+		if id > last {
+			last = id
+		}
+	}
+	var rows []string
+	for i, row := range mt.Cells {
+		if mt.runIDs[i] == last {
+			rows = append(rows, rowKey(row))
+		}
+	}
+	return rows
+}
+
+// index returns the index of the row with the same natural key or -1.
+func (mt *memTable) index(key []string, row []interface{}, date time.Time) int {
+	if len(key) == 0 {
+		return -1
+	}
+	k := mt.keyValues(key, row, date)
+	for i, r := range mt.Cells {
+		if mt.keyValues(key, r, mt.dates[i]) == k {
+			return i
+		}
+	}
+	return -1
+}
+
+func (mt *memTable) keyValues(key []string, row []interface{}, date time.Time) string {
+	colNames := mt.GetColumnNames()
+	vals := make([]interface{}, len(key))
+	for i, k := range key {
+		if k == "date" {
+			vals[i] = date
+		} else {
+			vals[i] = row[index(colNames, k)]
+		}
+	}
+	return rowKey(vals)
+}
+
+// Table returns a copy of all rows written to the named table.
+func (m *MemSink) Table(name string) *Table {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mt, ok := m.tables[name]
+	if !ok {
+		return nil
+	}
+	t := *mt.Table
+	t.Cells = append([][]interface{}(nil), mt.Cells...)
+	return &t
+}
+
+// Runs returns all scrape runs written.
+func (m *MemSink) Runs() []Run {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Run(nil), m.runs...)
+}
+
+func (m *MemSink) Close() error {
+	return nil
+}
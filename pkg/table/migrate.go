@@ -0,0 +1,124 @@
+package table
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const migrationsTable = "schema_migrations"
+
+type migration struct {
+	stmt        string
+	destructive bool
+}
+
+// migrateSchema alters an existing Postgres table to match the columns of
+// t and records every applied statement in the schema_migrations table.
+// New columns are added as nullable, dropping columns and changing column
+// types requires allowDestructive.
+func migrateSchema(ctx context.Context, db *sql.DB, t *Table, allowDestructive bool) error {
+	want, err := getPQTypeMap(t)
+	if err != nil {
+		return err
+	}
+	got, err := getColumnTypes(ctx, db, t.Name)
+	if err != nil {
+		return err
+	}
+	migrations := planMigration(t, want, got)
+	if len(migrations) == 0 {
+		return nil
+	}
+	if !allowDestructive {
+		var destructive []string
+		for _, m := range migrations {
+			if m.destructive {
+				destructive = append(destructive, m.stmt)
+			}
+		}
+		if len(destructive) > 0 {
+			return fmt.Errorf("destructive migration not allowed: %s", strings.Join(destructive, "; "))
+		}
+	}
+	return applyMigrations(ctx, db, t.Name, migrations)
+}
+
+func planMigration(t *Table, want, got map[string]string) []migration {
+	var migrations []migration
+	for _, col := range t.GetColumnNames() {
+		gotType, ok := got[col]
+		switch {
+		case !ok:
+			stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", t.Name, col, want[col])
+			migrations = append(migrations, migration{stmt: stmt})
+		case gotType != want[col]:
+			stmt := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s", t.Name, col, want[col], col, want[col])
+			migrations = append(migrations, migration{stmt: stmt, destructive: true})
+		}
+	}
+	var dropped []string
+	for col := range got {
+		if _, ok := want[col]; !ok {
+			dropped = append(dropped, col)
+		}
+	}
+	sort.Strings(dropped)
+	for _, col := range dropped {
+		stmt := fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", t.Name, col)
+		migrations = append(migrations, migration{stmt: stmt, destructive: true})
+	}
+	return migrations
+}
+
+func getColumnTypes(ctx context.Context, db *sql.DB, tableName string) (map[string]string, error) {
+	q := "SELECT column_name, data_type FROM information_schema.columns WHERE table_name = $1;"
+	rows, err := db.QueryContext(ctx, q, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types := map[string]string{}
+	for rows.Next() {
+		var colName, dataType string
+		if err := rows.Scan(&colName, &dataType); err != nil {
+			return nil, err
+		}
+		types[colName] = dataType
+	}
+	return types, rows.Err()
+}
+
+func applyMigrations(ctx context.Context, db *sql.DB, tableName string, migrations []migration) error {
+	stmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id serial PRIMARY KEY,
+		table_name text NOT NULL,
+		statement text NOT NULL,
+		applied timestamp NOT NULL
+	)`, migrationsTable)
+	if _, err := db.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	applied := time.Now().UTC()
+	insert := fmt.Sprintf("INSERT INTO %s (table_name, statement, applied) VALUES ($1, $2, $3)", migrationsTable)
+	for _, m := range migrations {
+		if _, err := txn.ExecContext(ctx, m.stmt); err != nil {
+			_ = txn.Rollback()
+			return fmt.Errorf("%s: %w", m.stmt, err)
+		}
+		if _, err := txn.ExecContext(ctx, insert, tableName, m.stmt, applied); err != nil {
+			_ = txn.Rollback()
+			return err
+		}
+	}
+	return txn.Commit()
+}
@@ -0,0 +1,141 @@
+package table
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// NumberFormat describes how numbers are written in cells of int, int64,
+// float64, percent and decimal columns, e.g. for German pages
+//
+//	{target_name: cases, type: int, thousands_sep: ".", decimal_sep: ","}
+//
+// Whitespace such as thin or non-breaking spaces used for digit grouping
+// is always ignored, as is a leading unicode minus sign "−".
+type NumberFormat struct {
+	ThousandsSep string   `yaml:"thousands_sep"` // default ","
+	DecimalSep   string   `yaml:"decimal_sep"`   // default "."
+	Prefixes     []string `yaml:"prefixes"`      // removed before parsing, e.g. "~" or "≈"
+	Suffixes     []string `yaml:"suffixes"`      // removed before parsing, e.g. "+" for "500+"
+	Magnitudes   bool     `yaml:"magnitudes"`    // allow magnitude suffixes such as "12k" or "1.5 million"
+}
+
+// magnitudes maps magnitude suffixes to powers of ten. Lower case "m" is
+// left out as it is ambiguous.
+var magnitudes = map[string]int{
+	"k": 3, "K": 3, "thousand": 3,
+	"M": 6, "mn": 6, "million": 6,
+	"B": 9, "bn": 9, "billion": 9,
+}
+
+func (f NumberFormat) isZero() bool {
+	return f.ThousandsSep == "" && f.DecimalSep == "" && len(f.Prefixes) == 0 && len(f.Suffixes) == 0 && !f.Magnitudes
+}
+
+func (f NumberFormat) thousandsSep() string {
+	if f.ThousandsSep == "" {
+		return ","
+	}
+	return f.ThousandsSep
+}
+
+func (f NumberFormat) decimalSep() string {
+	if f.DecimalSep == "" {
+		return "."
+	}
+	return f.DecimalSep
+}
+
+func (f NumberFormat) validate() error {
+	if f.thousandsSep() == f.decimalSep() {
+		return fmt.Errorf("same thousands and decimal separator '%s'", f.decimalSep())
+	}
+	return nil
+}
+
+// normalize returns c as Go number literal without digit grouping, e.g.
+// "~1.234,5" becomes "1234.5" for thousands separator "." and decimal
+// separator "," and prefix "~". Magnitude suffixes are applied by moving
+// the decimal point, so "1.2k" becomes "1200" without rounding.
+func (f NumberFormat) normalize(c string) (string, error) {
+	s := strings.TrimSpace(c)
+	s = trimAffixes(s, f.Prefixes, strings.TrimPrefix)
+	s = trimAffixes(s, f.Suffixes, strings.TrimSuffix)
+	exp := 0
+	if f.Magnitudes {
+		for suffix, e := range magnitudes {
+			if !strings.HasSuffix(s, suffix) {
+				continue
+			}
+			t := strings.TrimRightFunc(strings.TrimSuffix(s, suffix), unicode.IsSpace)
+			if t != "" && isDigit(t[len(t)-1]) {
+				s, exp = t, e
+				break
+			}
+		}
+	}
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.Replace(s, "−", "-", 1)
+	s = strings.ReplaceAll(s, f.thousandsSep(), "")
+	s = strings.Replace(s, f.decimalSep(), ".", 1)
+	if s == "" {
+		return "", fmt.Errorf("invalid number '%s'", c)
+	}
+	s, ok := shiftDecimal(s, exp)
+	if !ok {
+		return "", fmt.Errorf("invalid number '%s'", c)
+	}
+	return s, nil
+}
+
+func trimAffixes(s string, affixes []string, trim func(string, string) string) string {
+	for trimmed := ""; trimmed != s; {
+		trimmed = s
+		for _, a := range affixes {
+			s = strings.TrimSpace(trim(s, a))
+		}
+	}
+	return s
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// shiftDecimal multiplies the decimal number s by 10^exp, e.g. "1.25" and
+// 3 gives "1250". Leading zeros are removed, e.g. "0.5" and 3 gives
+// "500" rather than "0500". ok is false if s is not a plain decimal
+// number, e.g. "1.2.3", as shifting would turn it into a different one.
+func shiftDecimal(s string, exp int) (shifted string, ok bool) {
+	if exp == 0 {
+		return s, true
+	}
+	if !decimalRe.MatchString(strings.TrimPrefix(s, "+")) {
+		return "", false
+	}
+	sign := ""
+	if s[0] == '-' || s[0] == '+' {
+		sign, s = s[:1], s[1:]
+	}
+	intPart, frac := s, ""
+	if i := strings.Index(s, "."); i != -1 {
+		intPart, frac = s[:i], s[i+1:]
+	}
+	if len(frac) < exp {
+		frac += strings.Repeat("0", exp-len(frac))
+	}
+	intPart, frac = strings.TrimLeft(intPart+frac[:exp], "0"), frac[exp:]
+	if intPart == "" {
+		intPart = "0"
+	}
+	if frac != "" {
+		return sign + intPart + "." + frac, true
+	}
+	return sign + intPart, true
+}
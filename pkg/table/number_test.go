@@ -0,0 +1,95 @@
+package table
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCellNumberFormat(t *testing.T) {
+	german := NumberFormat{ThousandsSep: ".", DecimalSep: ","}
+	approx := NumberFormat{Prefixes: []string{"~", "≈"}, Suffixes: []string{"+", "*"}}
+	tests := map[string]struct {
+		input  string
+		colDef ColumnDef
+		want   interface{}
+	}{
+		"thin_space":       {input: "1\u2009234", colDef: ColumnDef{Type: IntType}, want: 1234},
+		"nbsp":             {input: "1\u00a0234\u00a0567", colDef: ColumnDef{Type: IntType}, want: 1234567},
+		"narrow_nbsp":      {input: "12\u202f345,5", colDef: ColumnDef{Type: Float64Type, NumberFormat: NumberFormat{ThousandsSep: ".", DecimalSep: ","}}, want: 12345.5},
+		"german_int":       {input: "1.234", colDef: ColumnDef{Type: IntType, NumberFormat: german}, want: 1234},
+		"german_float":     {input: "1.234,5", colDef: ColumnDef{Type: Float64Type, NumberFormat: german}, want: 1234.5},
+		"german_percent":   {input: "1,5 %", colDef: ColumnDef{Type: PercentType, NumberFormat: german}, want: 1.5},
+		"german_decimal":   {input: "1.234,50", colDef: ColumnDef{Type: DecimalType, NumberFormat: german}, want: json.Number("1234.50")},
+		"swiss":            {input: "1'234.5", colDef: ColumnDef{Type: Float64Type, NumberFormat: NumberFormat{ThousandsSep: "'"}}, want: 1234.5},
+		"delta":            {input: "+1,234", colDef: ColumnDef{Type: IntType}, want: 1234},
+		"unicode_minus":    {input: "−1,234", colDef: ColumnDef{Type: IntType}, want: -1234},
+		"approx":           {input: "~500", colDef: ColumnDef{Type: IntType, NumberFormat: approx}, want: 500},
+		"approx_space":     {input: "≈ 500+", colDef: ColumnDef{Type: IntType, NumberFormat: approx}, want: 500},
+		"approx_delta":     {input: "~+12*", colDef: ColumnDef{Type: IntType, NumberFormat: approx}, want: 12},
+		"magnitude_k":      {input: "12k", colDef: ColumnDef{Type: IntType, NumberFormat: NumberFormat{Magnitudes: true}}, want: 12000},
+		"magnitude_frac":   {input: "1.25 M", colDef: ColumnDef{Type: IntType, NumberFormat: NumberFormat{Magnitudes: true}}, want: 1250000},
+		"magnitude_word":   {input: "1.5 million", colDef: ColumnDef{Type: Float64Type, NumberFormat: NumberFormat{Magnitudes: true}}, want: 1.5e6},
+		"magnitude_comma":  {input: "2,5 bn", colDef: ColumnDef{Type: DecimalType, NumberFormat: NumberFormat{ThousandsSep: ".", DecimalSep: ",", Magnitudes: true}}, want: json.Number("2500000000")},
+		"magnitude_small":  {input: "0.5k", colDef: ColumnDef{Type: DecimalType, NumberFormat: NumberFormat{Magnitudes: true}}, want: json.Number("500")},
+		"magnitude_approx": {input: "~3.1234k+", colDef: ColumnDef{Type: DecimalType, NumberFormat: NumberFormat{Magnitudes: true, Prefixes: []string{"~"}, Suffixes: []string{"+"}}}, want: json.Number("3123.4")},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			got, err := parseCell(tc.input, tc.colDef)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseCellNumberFormatErr(t *testing.T) {
+	tests := map[string]ColumnDef{
+		"12k":     {Type: IntType},
+		"1.2345k": {Type: IntType, NumberFormat: NumberFormat{Magnitudes: true}},
+		"k":       {Type: IntType, NumberFormat: NumberFormat{Magnitudes: true}},
+		"~500":    {Type: IntType},
+		"~":       {Type: IntType, NumberFormat: NumberFormat{Prefixes: []string{"~"}}},
+		"1.2.3k":  {Type: DecimalType, NumberFormat: NumberFormat{Magnitudes: true}},
+		"1,2,3k":  {Type: DecimalType, NumberFormat: NumberFormat{ThousandsSep: ".", DecimalSep: ",", Magnitudes: true}},
+		"1e3k":    {Type: Float64Type, NumberFormat: NumberFormat{Magnitudes: true}},
+	}
+	for input, colDef := range tests {
+		input, colDef := input, colDef
+		t.Run(input, func(t *testing.T) {
+			_, err := parseCell(input, colDef)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestShiftDecimal(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		exp   int
+		want  string
+		ok    bool
+	}{
+		"int":        {input: "12", exp: 3, want: "12000", ok: true},
+		"frac":       {input: "1.25", exp: 3, want: "1250", ok: true},
+		"long":       {input: "1.23456", exp: 3, want: "1234.56", ok: true},
+		"neg":        {input: "-0.5", exp: 6, want: "-500000", ok: true},
+		"plus":       {input: "+2", exp: 3, want: "+2000", ok: true},
+		"small":      {input: "0.0005", exp: 3, want: "0.5", ok: true},
+		"zero":       {input: "0.000", exp: 3, want: "0", ok: true},
+		"no_shift":   {input: "1.5", exp: 0, want: "1.5", ok: true},
+		"two_points": {input: "1.2.3", exp: 3},
+		"non_digit":  {input: "1x5", exp: 3},
+		"sign_only":  {input: "-", exp: 3},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			got, ok := shiftDecimal(tc.input, tc.exp)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package table
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Report lists the table body rows rejected during scraping with
+// Scraper.ContinueOnError set.
+type Report struct {
+	RowCount int // number of table body rows, including rejected rows
+	Rejected []RejectedRow
+}
+
+type RejectedRow struct {
+	Index     int      // index of the row in the table body, after header rows
+	Cells     []string // raw cell text
+	Column    int      // index of failing column definition, -1 for wrong cell count
+	ColumnDef *ColumnDef
+	Err       error
+}
+
+// columnError is returned by parseRow for cells that cannot be parsed.
+type columnError struct {
+	column int
+	err    error
+}
+
+func (e *columnError) Error() string {
+	return fmt.Sprintf("column %d: %v", e.column, e.err)
+}
+
+func (e *columnError) Unwrap() error {
+	return e.err
+}
+
+func newRejectedRow(index int, row []cell, colDefs []ColumnDef, err error) RejectedRow {
+	r := RejectedRow{Index: index, Cells: getTexts(row), Column: -1, Err: err}
+	var colErr *columnError
+	if errors.As(err, &colErr) {
+		r.Column = colErr.column
+		r.ColumnDef = &colDefs[colErr.column]
+	}
+	return r
+}
+
+func (r *Report) String() string {
+	s := make([]string, 0, len(r.Rejected)+1)
+	s = append(s, fmt.Sprintf("rejected %d of %d rows", len(r.Rejected), r.RowCount))
+	for _, rr := range r.Rejected {
+		s = append(s, rr.String())
+	}
+	return strings.Join(s, "\n")
+}
+
+func (r RejectedRow) String() string {
+	return fmt.Sprintf("row %d: %v %q", r.Index, r.Err, r.Cells)
+}
+
+// checkRejected returns an error if more rows have been rejected than
+// allowed by Scraper.MaxRejectedRows or Scraper.MaxRejectedPercent.
+func (s *Scraper) checkRejected(r *Report) error {
+	cnt := len(r.Rejected)
+	if s.MaxRejectedRows > 0 && cnt > s.MaxRejectedRows {
+		return fmt.Errorf("rejected %d rows, more than %d allowed", cnt, s.MaxRejectedRows)
+	}
+	if s.MaxRejectedPercent > 0 && r.RowCount > 0 {
+		if p := 100 * float64(cnt) / float64(r.RowCount); p > s.MaxRejectedPercent {
+			return fmt.Errorf("rejected %.1f%% of rows, more than %.1f%% allowed", p, s.MaxRejectedPercent)
+		}
+	}
+	return nil
+}
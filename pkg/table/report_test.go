@@ -0,0 +1,62 @@
+package table
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", wikiFile2))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, report, err := wikiScraper2().scrapeFromReader(r)
+	require.NoError(t, err)
+	require.Equal(t, 233, report.RowCount)
+	require.Equal(t, 1, len(report.Rejected))
+
+	rejected := report.Rejected[0]
+	require.Equal(t, 224, rejected.Index)
+	require.Equal(t, []string{"International conveyances"}, rejected.Cells)
+	require.Equal(t, 2, rejected.Column)
+	require.Equal(t, "cases", rejected.ColumnDef.TargetName)
+	require.Error(t, rejected.Err)
+	require.Contains(t, report.String(), "rejected 1 of 233 rows\nrow 224: column 2: ")
+}
+
+func TestReportThreshold(t *testing.T) {
+	tests := map[string]struct {
+		maxRows    int
+		maxPercent float64
+		wantErr    bool
+	}{
+		"no_limit":      {},
+		"rows_ok":       {maxRows: 1},
+		"percent_ok":    {maxPercent: 0.5},
+		"percent_error": {maxPercent: 0.1, wantErr: true},
+	}
+	report := &Report{RowCount: 233, Rejected: make([]RejectedRow, 1)}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			s := wikiScraper2()
+			s.MaxRejectedRows = tc.maxRows
+			s.MaxRejectedPercent = tc.maxPercent
+			err := s.checkRejected(report)
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("rows_error", func(t *testing.T) {
+		s := wikiScraper2()
+		s.MaxRejectedRows = 1
+		require.Error(t, s.checkRejected(&Report{RowCount: 233, Rejected: make([]RejectedRow, 2)}))
+	})
+}
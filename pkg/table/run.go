@@ -0,0 +1,103 @@
+package table
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Run describes the scrape that produced a table. SQL sinks store it in
+// the scrape_runs table and reference it from every row with run_id;
+// rejected rows are stored in scrape_run_rejects.
+type Run struct {
+	ID             int64 // set by sinks when written
+	TableName      string
+	URL            string
+	Revision       string // page revision as matched by Scraper.RevisionPattern
+	ScraperVersion string
+	Started        time.Time
+	Duration       time.Duration
+	RowCount       int
+	RejectedCount  int
+	Rejected       []RejectedRow
+}
+
+const (
+	runsTable    = "scrape_runs"
+	rejectsTable = "scrape_run_rejects"
+)
+
+var createRejectsTableStmt = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		run_id integer NOT NULL REFERENCES %s (id),
+		row_index integer NOT NULL,
+		cells text NOT NULL,
+		error text NOT NULL
+	)`, rejectsTable, runsTable)
+
+// insertRejects stores the rejected rows of run with the statement q,
+// which inserts run_id, row_index, cells as JSON array and error.
+func insertRejects(ctx context.Context, txn *sql.Tx, q string, run *Run) error {
+	for _, r := range run.Rejected {
+		cells, err := json.Marshal(r.Cells)
+		if err != nil {
+			return err
+		}
+		errText := ""
+		if r.Err != nil {
+			errText = r.Err.Error()
+		}
+		if _, err := txn.ExecContext(ctx, q, run.ID, r.Index, string(cells), errText); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileRevisionPattern compiles Scraper.RevisionPattern, which is nil
+// if empty.
+func compileRevisionPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("revision pattern: %w", err)
+	}
+	return re, nil
+}
+
+func (c *CompiledScraper) getRevision(n *html.Node) string {
+	if c.revisionRe == nil {
+		return ""
+	}
+	return getRevision(n, c.revisionRe)
+}
+
+// getRevision returns the first submatch of re in the text of the
+// document's script elements, e.g. the "wgRevisionId" of Wikipedia pages.
+func getRevision(n *html.Node, re *regexp.Regexp) string {
+	if n.Type == html.ElementNode && n.Data == "script" {
+		if m := re.FindStringSubmatch(getText(n)); len(m) > 1 {
+			return m[1]
+		}
+		return ""
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if rev := getRevision(c, re); rev != "" {
+			return rev
+		}
+	}
+	return ""
+}
+
+func getRun(t *Table) *Run {
+	if t.Run != nil {
+		return t.Run
+	}
+	return &Run{TableName: t.Name, RowCount: len(t.Cells), Started: time.Now().UTC()}
+}
@@ -0,0 +1,97 @@
+package table
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrapeRun(t *testing.T) {
+	r, err := os.Open(filepath.Join("testdata", wikiFile2))
+	require.NoError(t, err)
+	defer r.Close()
+
+	s := wikiScraper2()
+	s.Version = "v1.2"
+	s.RevisionPattern = `"wgRevisionId":([0-9]+)`
+	table, _, err := s.scrapeFromReader(r)
+	require.NoError(t, err)
+
+	run := table.Run
+	require.Equal(t, "wiki_entries", run.TableName)
+	require.Equal(t, s.URL, run.URL)
+	require.Equal(t, "951664441", run.Revision)
+	require.Equal(t, "v1.2", run.ScraperVersion)
+	require.Equal(t, 232, run.RowCount)
+	require.Equal(t, 1, run.RejectedCount)
+	require.Equal(t, 1, len(run.Rejected))
+	require.False(t, run.Started.IsZero())
+}
+
+func TestSQLiteSinkRun(t *testing.T) {
+	sink, err := OpenSQLiteSink(filepath.Join(tempDir(t), "covid.db"))
+	require.NoError(t, err)
+	defer sink.Close()
+
+	table := sinkTableFixture()
+	rejected := RejectedRow{Index: 3, Cells: []string{"France", "n/a"}, Column: 1, Err: errors.New("column 1: invalid int")}
+	table.Run = &Run{TableName: "entries", URL: "https://example.com", Revision: "42", RowCount: 2,
+		RejectedCount: 1, Rejected: []RejectedRow{rejected}}
+	require.NoError(t, PersistTo(sink, table))
+	require.Equal(t, int64(1), table.Run.ID)
+	require.NoError(t, PersistTo(sink, sinkTableFixture()))
+
+	var revision string
+	var rowCount int
+	q := "SELECT revision, row_count FROM scrape_runs WHERE id = 1"
+	require.NoError(t, sink.db.QueryRow(q).Scan(&revision, &rowCount))
+	require.Equal(t, "42", revision)
+	require.Equal(t, 2, rowCount)
+
+	var runID, index int
+	var cells, errText string
+	q = "SELECT run_id, row_index, cells, error FROM scrape_run_rejects"
+	require.NoError(t, sink.db.QueryRow(q).Scan(&runID, &index, &cells, &errText))
+	require.Equal(t, 1, runID)
+	require.Equal(t, 3, index)
+	require.Equal(t, `["France","n/a"]`, cells)
+	require.Equal(t, "column 1: invalid int", errText)
+
+	var cnt int
+	require.NoError(t, sink.db.QueryRow("SELECT count(*) FROM entries WHERE run_id = 2").Scan(&cnt))
+	require.Equal(t, 2, cnt)
+}
+
+func TestMemSinkRuns(t *testing.T) {
+	sink := NewMemSink()
+	persistTwice(t, sink)
+	runs := sink.Runs()
+	require.Equal(t, 2, len(runs))
+	require.Equal(t, int64(2), runs[1].ID)
+	require.Equal(t, "entries", runs[1].TableName)
+}
+
+func TestSQLiteSinkAddRunID(t *testing.T) {
+	sink, err := OpenSQLiteSink(filepath.Join(tempDir(t), "covid.db"))
+	require.NoError(t, err)
+	defer sink.Close()
+	_, err = sink.db.Exec(`CREATE TABLE entries (
+		id integer PRIMARY KEY AUTOINCREMENT,
+		date timestamp NOT NULL,
+		country text,
+		cases integer,
+		rate real
+	)`)
+	require.NoError(t, err)
+	_, err = sink.db.Exec("INSERT INTO entries (date, country, cases, rate) VALUES ('2020-04-01', 'Italy', 100, 1.0)")
+	require.NoError(t, err)
+
+	require.NoError(t, PersistTo(sink, sinkTableFixture()))
+	var cnt, runs int
+	require.NoError(t, sink.db.QueryRow("SELECT count(*), count(run_id) FROM entries").Scan(&cnt, &runs))
+	require.Equal(t, 3, cnt)
+	require.Equal(t, 2, runs)
+}
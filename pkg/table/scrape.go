@@ -1,58 +1,168 @@
 package table
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"net/url"
-	"reflect"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/juliaogris/covid19/pkg/htmlx"
 	"golang.org/x/net/html"
 )
 
 type Scraper struct {
-	URL               string
-	CSSSelector       string
-	SkipTrCSSSelector string
+	URL               string `yaml:"url"`
+	CSSSelector       string `yaml:"css_selector"`
+	XPath             string `yaml:"xpath"`   // alternative to CSSSelector
+	Caption           string `yaml:"caption"` // locate table by caption and HeaderColNames if no selector is given
+	SkipTrCSSSelector string `yaml:"skip_tr_css_selector"`
 
-	ColumnDefs []ColumnDef
+	ColumnDefs []ColumnDef `yaml:"column_defs"`
 
-	HeaderRowIndex  int
-	HeaderColNames  []string
-	HeaderRowCount  int
-	FooterRowCount  int
-	ContinueOnError bool
+	HeaderRowIndex  int      `yaml:"header_row_index"`
+	HeaderColNames  []string `yaml:"header_col_names"`
+	HeaderRowCount  int      `yaml:"header_row_count"`
+	FooterRowCount  int      `yaml:"footer_row_count"`
+	ContinueOnError bool     `yaml:"continue_on_error"`
 
-	TargetTableName string
-	TargetColNames  []string // must match ColumnDefs[i].TargetName; for rearranging
+	MapColumnsByHeader bool `yaml:"map_columns_by_header"` // bind ColumnDefs[i] to the column whose header contains HeaderColNames[i]
+	FlattenHeader      bool `yaml:"flatten_header"`        // combine header rows into names like cases_total for HeaderColNames and default TargetNames
+
+	MaxRejectedRows    int     `yaml:"max_rejected_rows"`    // fail if more rows are rejected, 0 for no limit
+	MaxRejectedPercent float64 `yaml:"max_rejected_percent"` // fail if more percent of rows are rejected, 0 for no limit
+
+	TargetTableName string   `yaml:"target_table_name"`
+	TargetColNames  []string `yaml:"target_col_names"` // must match ColumnDefs[i].TargetName; for rearranging
+	KeyColNames     []string `yaml:"key_col_names"`    // natural key, ColumnDefs[i].TargetName or "date"
+	SkipUnchanged   bool     `yaml:"skip_unchanged"`   // don't write rows equal to the last snapshot
+
+	Version         string `yaml:"version"`          // recorded with every scrape run
+	RevisionPattern string `yaml:"revision_pattern"` // regexp matching page revision in scripts, e.g. `"wgRevisionId":([0-9]+)`
+
+	// Data-as-of time used as date column, falls back to scrape time.
+	AsOfCSSSelector  string `yaml:"as_of_css_selector"`  // element containing as-of date
+	AsOfPattern      string `yaml:"as_of_pattern"`       // regexp with date submatch, e.g. `As of (\d+ \w+ \d{4})`
+	AsOfLayout       string `yaml:"as_of_layout"`        // time.Parse layout, e.g. "2 January 2006"
+	AsOfLastModified bool   `yaml:"as_of_last_modified"` // use HTTP Last-Modified header if not found in document
+
+	Fetcher *Fetcher `yaml:"-"` // DefaultFetcher if nil
+}
+
+// selectors are the compiled selectors of a Scraper.
+type selectors struct {
+	table *htmlx.CompiledSelector // CSSSelector
+	xpath *htmlx.XPath            // XPath
+	asOf  *htmlx.CompiledSelector // AsOfCSSSelector
 }
 
 type ColumnDef struct { //nolint:maligned
-	Skip bool
+	Skip bool `yaml:"skip"`
+
+	TargetName   string   `yaml:"target_name"`
+	Type         ColType  `yaml:"type"`
+	Layout       string   `yaml:"layout"`        // time.Parse layout for date and time types, default "2006-01-02" and RFC 3339
+	ZeroValues   []string `yaml:"zero_values"`   // e.g. "-" for numbers
+	Nullable     bool     `yaml:"nullable"`      // use NULL instead of zero values, also for empty cells
+	TruncateFrom string   `yaml:"truncate_from"` // e.g. "[" to remove reference in wikipedia "[a]"
+	NoTrim       bool     `yaml:"no_trim"`       // don't trim whitespace
+	BlankSpanned bool     `yaml:"blank_spanned"` // use zero value instead of repeating rowspan or colspan cells
+	Kind         CellKind `yaml:"kind"`          // "header" for th, "data" for td cells, any if empty
+	Header       string   `yaml:"header"`        // case-insensitive regexp binding the column by header text
+	Optional     bool     `yaml:"optional"`      // use zero values if no column matches Header
 
-	TargetName   string
-	Type         reflect.Kind
-	ZeroValues   []string // e.g. "-" for numbers
-	TruncateFrom string   // e.g. "[" to remove reference in wikipedia "[a]"
-	NoTrim       bool     // don't trim whitespace
+	Source   CellSource `yaml:"source"`   // "text" (default), "attr", "link_href" or "link_title"
+	Attr     string     `yaml:"attr"`     // attribute for source "attr", e.g. data-sort-value
+	Selector string     `yaml:"selector"` // CSS selector for the element within the cell to use as source
+
+	Transforms []TransformDef `yaml:"transforms"` // applied in order after TruncateFrom and trimming
+
+	NumberFormat `yaml:",inline"`
+
+	transforms []TransformFunc         // compiled Transforms
+	selector   *htmlx.CompiledSelector // compiled Selector
 }
 
-func (s *Scraper) Scrape() (*Table, error) {
-	if err := ValidateScraper(s); err != nil {
-		return nil, err
+// Scrape fetches and parses the page at s.URL. The Scrape methods of
+// Scraper compile s for every call, see CompileScraper for scraping
+// repeatedly with the same definition.
+func (s *Scraper) Scrape() (*Table, *Report, error) {
+	return s.ScrapeContext(context.Background())
+}
+
+// ScrapeContext is Scrape with a context, see CompiledScraper.ScrapeContext.
+func (s *Scraper) ScrapeContext(ctx context.Context) (*Table, *Report, error) {
+	c, err := CompileScraper(s)
+	if err != nil {
+		return nil, nil, err
 	}
-	resp, err := http.Get(s.URL)
+	return c.ScrapeContext(ctx)
+}
+
+// ScrapePage parses a previously fetched page, see
+// CompiledScraper.ScrapePage.
+func (s *Scraper) ScrapePage(page *Page) (*Table, *Report, error) {
+	c, err := CompileScraper(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.ScrapePage(page)
+}
+
+// ScrapeReader parses the HTML page read from r, e.g. a saved copy of
+// the page at s.URL.
+func (s *Scraper) ScrapeReader(r io.Reader) (*Table, *Report, error) {
+	return s.scrapeFromReader(r)
+}
+
+// ScrapeNode extracts the table from the parsed HTML document n.
+func (s *Scraper) ScrapeNode(n *html.Node) (*Table, *Report, error) {
+	c, err := CompileScraper(s)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	return c.ScrapeNode(n)
+}
+
+func (s *Scraper) scrapeFromReader(r io.Reader) (*Table, *Report, error) {
+	c, err := CompileScraper(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.scrapeFromReader(r)
+}
+
+// Forget makes the next Scrape fetch s.URL unconditionally, e.g. after
+// the scraped table could not be persisted.
+func (s *Scraper) Forget() {
+	s.GetFetcher().Forget(s.fetchKey())
+}
+
+// fetchKey keys the conditional request validators of s, so that
+// scrapers of different tables on the same page do not share them.
+func (s *Scraper) fetchKey() string {
+	return s.URL + " " + s.TargetTableName
+}
+
+// GetFetcher returns the Fetcher used by Scrape.
+func (s *Scraper) GetFetcher() *Fetcher {
+	if s.Fetcher == nil {
+		return DefaultFetcher
 	}
-	defer resp.Body.Close()
-	return s.scrapeFromReader(resp.Body)
+	return s.Fetcher
 }
 
+// ValidateScraper checks the definition s without changing it, see
+// CompileScraper.
 func ValidateScraper(s *Scraper) error {
+	_, err := CompileScraper(s)
+	return err
+}
+
+// validateScraper checks the parts of s that are not compiled by
+// CompileScraper.
+func validateScraper(s *Scraper) error {
 	if _, err := url.Parse(s.URL); err != nil {
 		return err
 	}
@@ -61,90 +171,257 @@ func ValidateScraper(s *Scraper) error {
 			return fmt.Errorf("header row index outside header row count")
 		}
 	}
+	if s.MaxRejectedRows < 0 || s.MaxRejectedPercent < 0 || s.MaxRejectedPercent > 100 {
+		return fmt.Errorf("invalid rejected rows threshold")
+	}
+	if s.FlattenHeader && s.HeaderRowCount == 0 {
+		return fmt.Errorf("flatten header without header rows")
+	}
+	if err := validateColumnDefs(s.ColumnDefs, s.FlattenHeader && !s.mapsColumns()); err != nil {
+		return err
+	}
+	if err := s.validateColumnMapping(); err != nil {
+		return err
+	}
+	return validateKeyColNames(s.KeyColNames, s.ColumnDefs)
+}
+
+// compileSelectors compiles CSSSelector or XPath and AsOfCSSSelector.
+func (s *Scraper) compileSelectors() (selectors, error) {
+	var sel selectors
+	var err error
+	switch {
+	case s.XPath != "":
+		if s.CSSSelector != "" {
+			return sel, fmt.Errorf("both css selector and xpath given")
+		}
+		if sel.xpath, err = htmlx.CompileXPath(s.XPath); err != nil {
+			return sel, fmt.Errorf("xpath: %w", err)
+		}
+		if !sel.xpath.SelectsNodes() {
+			return sel, fmt.Errorf("xpath: '%s' does not select nodes", s.XPath)
+		}
+	case s.CSSSelector != "":
+		if sel.table, err = htmlx.Compile(s.CSSSelector); err != nil {
+			return sel, fmt.Errorf("css selector: %w", err)
+		}
+	case s.Caption == "" && len(s.HeaderColNames) == 0:
+		return sel, fmt.Errorf("no css selector, xpath, caption or header column names")
+	}
+	if s.AsOfCSSSelector != "" {
+		if sel.asOf, err = htmlx.Compile(s.AsOfCSSSelector); err != nil {
+			return sel, fmt.Errorf("as of css selector: %w", err)
+		}
+	}
+	return sel, nil
+}
+
+func validateKeyColNames(keyColNames []string, colDefs []ColumnDef) error {
+	for _, k := range keyColNames {
+		if k == "date" {
+			continue
+		}
+		found := false
+		for _, colDef := range colDefs {
+			// default target names are only known at scrape time
+			if !colDef.Skip && (colDef.TargetName == k || colDef.TargetName == "") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown key column '%s'", k)
+		}
+	}
 	return nil
 }
 
-func (s *Scraper) scrapeFromReader(r io.Reader) (*Table, error) {
+// validateColumnDefs validates colDefs. TargetNames may be empty if
+// defaultNames is set, see withDefaultTargetNames.
+func validateColumnDefs(colDefs []ColumnDef, defaultNames bool) error {
+	if len(colDefs) == 0 {
+		return fmt.Errorf("no column definitions")
+	}
+	for i, colDef := range colDefs {
+		if colDef.Skip {
+			continue
+		}
+		if colDef.TargetName == "" && !defaultNames {
+			return fmt.Errorf("column %d: no target name", i)
+		}
+		if _, err := zero(colDef.Type); err != nil {
+			return fmt.Errorf("column %d: %w", i, err)
+		}
+		if colDef.Layout != "" && colDef.Type != DateType && colDef.Type != TimeType {
+			return fmt.Errorf("column %d: layout for %s column", i, colDef.Type)
+		}
+		if !colDef.NumberFormat.isZero() && !isNumeric(colDef.Type) {
+			return fmt.Errorf("column %d: number format for %s column", i, colDef.Type)
+		}
+		if err := colDef.NumberFormat.validate(); err != nil {
+			return fmt.Errorf("column %d: %w", i, err)
+		}
+		if err := validateSource(colDef); err != nil {
+			return fmt.Errorf("column %d: %w", i, err)
+		}
+		if colDef.Kind != AnyCell && colDef.Kind != HeaderCell && colDef.Kind != DataCell {
+			return fmt.Errorf("column %d: unknown cell kind '%s'", i, colDef.Kind)
+		}
+	}
+	return nil
+}
+
+func (c *CompiledScraper) scrapeFromReader(r io.Reader) (*Table, *Report, error) {
 	node, err := html.Parse(r)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	tableContainer, err := htmlx.QuerySelector(node, s.CSSSelector)
+	return c.scrapeNode(node)
+}
+
+func (c *CompiledScraper) scrapeNode(node *html.Node) (*Table, *Report, error) {
+	s := c.def
+	s.ColumnDefs = c.colDefs
+	asOf, err := c.getAsOf(node)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	tableContainer, err := s.queryTable(node, c.sel)
+	if err != nil {
+		return nil, nil, err
 	}
 	rows := getRows(tableContainer)
 	if len(rows) < s.HeaderRowCount+s.FooterRowCount {
-		return nil, fmt.Errorf("expected at least %d rows, got %d", s.HeaderRowCount+s.FooterRowCount, len(rows))
-	}
-	if err := vaildateTableHeader(rows, s.HeaderColNames, s.HeaderRowIndex); err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("expected at least %d rows, got %d", s.HeaderRowCount+s.FooterRowCount, len(rows))
 	}
+	colDefs := s.ColumnDefs
 	bodyRows := rows[s.HeaderRowCount : len(rows)-s.FooterRowCount]
-	table, err := parseTableBody(bodyRows, s.ColumnDefs, s.ContinueOnError)
+	if s.mapsColumns() {
+		var missing int
+		if colDefs, missing, err = s.resolveColumnDefs(rows[:s.HeaderRowCount]); err != nil {
+			return nil, nil, err
+		}
+		bodyRows = padMissing(bodyRows, missing)
+	} else if s.FlattenHeader {
+		names := flattenHeader(rows[:s.HeaderRowCount])
+		if err := validateHeader(names, s.HeaderColNames); err != nil {
+			return nil, nil, err
+		}
+		if colDefs, err = withDefaultTargetNames(colDefs, names); err != nil {
+			return nil, nil, err
+		}
+	} else if err := vaildateTableHeader(rows, s.HeaderColNames, s.HeaderRowIndex); err != nil {
+		return nil, nil, err
+	}
+	table, report, err := parseTableBody(bodyRows, colDefs, s.ContinueOnError)
 	if err != nil {
-		return nil, err
+		return nil, report, err
+	}
+	if err := s.checkRejected(report); err != nil {
+		return nil, report, err
 	}
 	table.Name = s.TargetTableName
-	if len(s.TargetColNames) != 0 {
-		if err := table.RearrangeColumns(s.TargetColNames); err != nil {
-			return nil, err
+	table.Key = s.KeyColNames
+	table.SkipUnchanged = s.SkipUnchanged
+	table.AsOf = asOf
+	table.Run = &Run{
+		TableName:      s.TargetTableName,
+		URL:            s.URL,
+		Revision:       c.getRevision(node),
+		ScraperVersion: s.Version,
+		Started:        time.Now().UTC(),
+		RowCount:       len(table.Cells),
+		RejectedCount:  len(report.Rejected),
+		Rejected:       report.Rejected,
+	}
+	targetColNames := s.TargetColNames
+	if len(targetColNames) == 0 && s.mapsColumns() {
+		targetColNames = getTargetColNames(s.ColumnDefs)
+	}
+	if len(targetColNames) != 0 {
+		if err := table.RearrangeColumns(targetColNames); err != nil {
+			return nil, report, err
+		}
+	}
+	return table, report, nil
+}
+
+// compileColumnDefs returns a copy of colDefs with compiled transforms
+// and selectors, so that they are not compiled for every cell.
+func compileColumnDefs(colDefs []ColumnDef) ([]ColumnDef, error) {
+	result := make([]ColumnDef, len(colDefs))
+	for i, colDef := range colDefs {
+		fns, err := compileTransforms(colDef.Transforms)
+		if err != nil {
+			return nil, fmt.Errorf("column %d: %w", i, err)
 		}
+		colDef.transforms = fns
+		if colDef.Selector != "" {
+			if colDef.selector, err = htmlx.Compile(colDef.Selector); err != nil {
+				return nil, fmt.Errorf("column %d: %w", i, err)
+			}
+		}
+		result[i] = colDef
 	}
-	return table, nil
+	return result, nil
 }
 
-func getRows(table *html.Node) [][]string {
-	trs := htmlx.QueryAllNoChildren(table, &htmlx.Selector{Tag: "tr"})
-	rows := make([][]string, len(trs))
-	for i, tr := range trs {
-		rows[i] = getRow(tr)
+func (s *Scraper) queryTable(n *html.Node, sel selectors) (*html.Node, error) {
+	switch {
+	case sel.xpath != nil:
+		return sel.xpath.Query(n), nil
+	case sel.table != nil:
+		return sel.table.Query(n), nil
 	}
-	return rows
+	return s.locateTable(n)
 }
 
-func getRow(tr *html.Node) []string {
-	th := htmlx.QueryAllNoChildren(tr, &htmlx.Selector{Tag: "th"})
-	td := htmlx.QueryAllNoChildren(tr, &htmlx.Selector{Tag: "td"})
-	cells := append(th, td...)
-	row := make([]string, len(cells))
-	for i, cell := range cells {
-		row[i] = strings.TrimSpace(getText(cell))
+func vaildateTableHeader(rows [][]cell, colNames []string, rowIndex int) error {
+	if len(colNames) == 0 {
+		return nil
 	}
-	return row
+	return validateHeader(getTexts(rows[rowIndex]), colNames)
 }
 
-func vaildateTableHeader(rows [][]string, colNames []string, rowIndex int) error {
+// validateHeader checks that every header contains the column name at the
+// same position, ignoring case.
+func validateHeader(cells []string, colNames []string) error {
 	if len(colNames) == 0 {
 		return nil
 	}
-	cells := rows[rowIndex]
 	if len(cells) != len(colNames) {
 		return fmt.Errorf("expected %d columns, got %d", len(colNames), len(cells))
 	}
 	for i, colName := range colNames {
-		s := strings.ToLower(strings.TrimSpace(cells[i]))
-		if !strings.Contains(s, strings.ToLower(colName)) {
-			return fmt.Errorf("expected header '%s' to contain '%s'", s, colName)
+		if !headerMatches(cells[i], colName) {
+			return fmt.Errorf("expected header '%s' to contain '%s'", strings.ToLower(strings.TrimSpace(cells[i])), colName)
 		}
 	}
 	return nil
 }
 
-func parseTableBody(rows [][]string, colDefs []ColumnDef, continueOnErr bool) (*Table, error) {
+// headerMatches reports whether the header cell text contains colName,
+// ignoring case.
+func headerMatches(text, colName string) bool {
+	return strings.Contains(strings.ToLower(strings.TrimSpace(text)), strings.ToLower(colName))
+}
+
+func parseTableBody(rows [][]cell, colDefs []ColumnDef, continueOnErr bool) (*Table, *Report, error) {
 	cells := make([][]interface{}, 0, len(rows))
-	for _, row := range rows {
-		row, err := parseRow(row, colDefs)
+	report := &Report{RowCount: len(rows)}
+	for i, row := range rows {
+		parsed, err := parseRow(row, colDefs)
 		if err != nil {
+			report.Rejected = append(report.Rejected, newRejectedRow(i, row, colDefs, err))
 			if continueOnErr {
 				continue
 			}
-			return nil, err
+			return nil, report, err
 		}
-		cells = append(cells, row)
+		cells = append(cells, parsed)
 	}
 	columns := getTargetColumns(colDefs)
-	return &Table{Columns: columns, Cells: cells}, nil
+	return &Table{Columns: columns, Cells: cells}, report, nil
 }
 
 func getTargetColCnt(colDefs []ColumnDef) int {
@@ -168,9 +445,9 @@ func getTargetColumns(colDefs []ColumnDef) []Column {
 	return cols
 }
 
-func parseRow(row []string, colDefs []ColumnDef) ([]interface{}, error) {
+func parseRow(row []cell, colDefs []ColumnDef) ([]interface{}, error) {
 	if len(row) != len(colDefs) {
-		return nil, fmt.Errorf("expected %d data cells, got %d (%#v)", len(colDefs), len(row), row)
+		return nil, fmt.Errorf("expected %d data cells, got %d (%#v)", len(colDefs), len(row), getTexts(row))
 	}
 	var err error
 	result := make([]interface{}, getTargetColCnt(colDefs))
@@ -179,9 +456,16 @@ func parseRow(row []string, colDefs []ColumnDef) ([]interface{}, error) {
 		if colDef.Skip {
 			continue
 		}
-		result[j], err = parseCell(row[i], colDef)
+		if !row[i].missing && colDef.Kind != AnyCell && colDef.Kind != row[i].kind() {
+			return nil, &columnError{column: i, err: fmt.Errorf("expected %s cell, got %s cell", colDef.Kind, row[i].kind())}
+		}
+		if row[i].missing || (row[i].spanned && colDef.BlankSpanned) {
+			result[j], err = colDef.zero()
+		} else {
+			result[j], err = parseCell(colDef.cellText(row[i]), colDef)
+		}
 		if err != nil {
-			return nil, err
+			return nil, &columnError{column: i, err: err}
 		}
 		j++
 	}
@@ -197,43 +481,19 @@ func parseCell(c string, colDef ColumnDef) (interface{}, error) {
 	if !colDef.NoTrim {
 		c = strings.TrimSpace(c)
 	}
-	if contains(colDef.ZeroValues, c) {
-		return zero(colDef.Type)
-	}
-	switch colDef.Type {
-	case reflect.String:
-		return c, nil
-	case reflect.Int, reflect.Int64:
-		c = strings.ReplaceAll(c, ",", "")
-		return strconv.Atoi(c)
-	case reflect.Float64:
-		c = strings.ReplaceAll(c, ",", "")
-		return strconv.ParseFloat(c, 64)
-	}
-	return nil, fmt.Errorf("unknown column type %s", colDef.Type)
-}
-
-func zero(k reflect.Kind) (interface{}, error) {
-	switch k {
-	case reflect.String:
-		return "", nil
-	case reflect.Int, reflect.Int64:
-		return 0, nil
-	case reflect.Float64:
-		return 0.0, nil
-	}
-	return nil, fmt.Errorf("unknown kind %s", k)
-}
-
-func getText(n *html.Node) string {
-	if n.Type == html.TextNode {
-		return strings.Trim(n.Data, "\n")
+	if len(colDef.Transforms) != 0 {
+		var err error
+		if c, err = colDef.transform(c); err != nil {
+			return nil, err
+		}
+		if !colDef.NoTrim {
+			c = strings.TrimSpace(c)
+		}
 	}
-	var sb strings.Builder
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		sb.WriteString(getText(c))
+	if contains(colDef.ZeroValues, c) || (colDef.Nullable && c == "" && colDef.Type != StringType) {
+		return colDef.zero()
 	}
-	return sb.String()
+	return parseValue(c, colDef)
 }
 
 func contains(slice []string, str string) bool {
@@ -1,12 +1,14 @@
 package table
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
 )
 
 const wikiFile = "wikipedia_2020-04-05.htm"
@@ -21,10 +23,10 @@ func wikiScraper() *Scraper {
 		CSSSelector: "div#covid19-container table.wikitable",
 		ColumnDefs: []ColumnDef{
 			{Skip: true},
-			{TargetName: "country", Type: reflect.String, TruncateFrom: "["},
-			{TargetName: "cases", Type: reflect.Int, ZeroValues: wikiZeroValues},
-			{TargetName: "deaths", Type: reflect.Int, ZeroValues: wikiZeroValues},
-			{TargetName: "recoveries", Type: reflect.Int, ZeroValues: wikiZeroValues},
+			{TargetName: "country", Type: StringType, TruncateFrom: "["},
+			{TargetName: "cases", Type: IntType, ZeroValues: wikiZeroValues},
+			{TargetName: "deaths", Type: IntType, ZeroValues: wikiZeroValues},
+			{TargetName: "recoveries", Type: IntType, ZeroValues: wikiZeroValues},
 			{Skip: true},
 		},
 		HeaderRowIndex:  0,
@@ -46,11 +48,11 @@ func mapScraper() *Scraper {
 		URL:         "https://google.com/covid19-map",
 		CSSSelector: "div.table_container div.table_scroll.table_height table",
 		ColumnDefs: []ColumnDef{
-			{TargetName: "country", Type: reflect.String},
-			{TargetName: "cases", Type: reflect.Int, ZeroValues: wikiZeroValues},
-			{TargetName: "cases1m", Type: reflect.Float64, ZeroValues: wikiZeroValues},
-			{TargetName: "recovered", Type: reflect.Int, ZeroValues: wikiZeroValues},
-			{TargetName: "deaths", Type: reflect.Int, ZeroValues: wikiZeroValues},
+			{TargetName: "country", Type: StringType},
+			{TargetName: "cases", Type: IntType, ZeroValues: wikiZeroValues},
+			{TargetName: "cases1m", Type: Float64Type, ZeroValues: wikiZeroValues},
+			{TargetName: "recovered", Type: IntType, ZeroValues: wikiZeroValues},
+			{TargetName: "deaths", Type: IntType, ZeroValues: wikiZeroValues},
 		},
 		HeaderRowIndex:  0,
 		HeaderColNames:  []string{"Location", "Confirmed cases", "Cases per 1M people", "Recovered", "Deaths"},
@@ -64,6 +66,10 @@ func TestScrapeTable(t *testing.T) {
 	scraper := wikiScraper()
 	require.NoError(t, ValidateScraper(scraper))
 
+	xpathWikiScraper := wikiScraper()
+	xpathWikiScraper.CSSSelector = ""
+	xpathWikiScraper.XPath = "//div[@id='covid19-container']//table[contains(concat(' ', @class, ' '), ' wikitable ')]"
+
 	rearrangedWikiScraper := wikiScraper()
 	rearrangedWikiScraper.TargetColNames = []string{"deaths", "country", "cases", "recoveries"}
 
@@ -73,6 +79,7 @@ func TestScrapeTable(t *testing.T) {
 		wantRowCnt   int
 		wantColNames []string
 		wantCells0   []interface{}
+		wantRejected int
 	}{
 		"wiki": {
 			inputFile:    wikiFile,
@@ -87,6 +94,7 @@ func TestScrapeTable(t *testing.T) {
 			wantRowCnt:   232,
 			wantColNames: []string{"country", "cases", "deaths", "recoveries"},
 			wantCells0:   []interface{}{"United States", 712184, 32823, 59532},
+			wantRejected: 1,
 		},
 		"map": {
 			inputFile:    mapFile,
@@ -95,6 +103,13 @@ func TestScrapeTable(t *testing.T) {
 			wantColNames: []string{"country", "cases", "cases1m", "recovered", "deaths"},
 			wantCells0:   []interface{}{"Worldwide", 303594, 43.09, 94625, 12964},
 		},
+		"xpath_wiki": {
+			inputFile:    wikiFile,
+			scraper:      xpathWikiScraper,
+			wantRowCnt:   223,
+			wantColNames: []string{"country", "cases", "deaths", "recoveries"},
+			wantCells0:   []interface{}{"United States", 311616, 8489, 14943},
+		},
 		"rearranged_wiki": {
 			inputFile:    wikiFile,
 			scraper:      rearrangedWikiScraper,
@@ -111,9 +126,11 @@ func TestScrapeTable(t *testing.T) {
 			r, err := os.Open(fpath)
 			require.NoError(t, err)
 
-			table, err := tc.scraper.scrapeFromReader(r)
+			table, report, err := tc.scraper.scrapeFromReader(r)
 			require.NoError(t, err)
 			require.NotNil(t, table)
+			require.Equal(t, tc.wantRejected, len(report.Rejected))
+			require.Equal(t, tc.wantRowCnt+tc.wantRejected, report.RowCount)
 
 			require.Equal(t, tc.scraper.TargetTableName, table.Name)
 			require.Equal(t, tc.wantRowCnt, len(table.Cells))
@@ -122,3 +139,34 @@ func TestScrapeTable(t *testing.T) {
 		})
 	}
 }
+
+func TestScrapeReaderNodeFile(t *testing.T) {
+	fpath, err := filepath.Abs(filepath.Join("testdata", wikiFile))
+	require.NoError(t, err)
+	b, err := ioutil.ReadFile(fpath)
+	require.NoError(t, err)
+
+	want, _, err := wikiScraper().ScrapeReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.NotEmpty(t, want.Cells)
+
+	node, err := html.Parse(bytes.NewReader(b))
+	require.NoError(t, err)
+	got, _, err := wikiScraper().ScrapeNode(node)
+	require.NoError(t, err)
+	require.Equal(t, want.Cells, got.Cells)
+
+	s := wikiScraper()
+	s.URL = "file://" + filepath.ToSlash(fpath)
+	got, _, err = s.Scrape()
+	require.NoError(t, err)
+	require.Equal(t, want.Cells, got.Cells)
+	require.Equal(t, s.URL, got.Run.URL)
+
+	s.URL = "file://" + filepath.ToSlash(fpath) + ".missing"
+	_, _, err = s.Scrape()
+	require.Error(t, err)
+	s.URL = "file://example.com/" + wikiFile
+	_, _, err = s.Scrape()
+	require.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package table
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/juliaogris/covid19/pkg/table/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+func sinkTableFixture() *Table {
+	return &Table{
+		Name: "entries",
+		Columns: []Column{
+			{"country", StringType},
+			{"cases", IntType},
+			{"rate", Float64Type},
+		},
+		Cells: [][]interface{}{
+			{"Italy", 200, 1.5},
+			{"Spain", 100, 0.25},
+		},
+	}
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "covid19-sink")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestOpenSink(t *testing.T) {
+	dir := tempDir(t)
+	tests := map[string]struct {
+		conn string
+		want Sink
+	}{
+		"sqlite": {conn: "sqlite://" + filepath.Join(dir, "covid.db"), want: &SQLiteSink{}},
+		"csv":    {conn: "csv://" + dir, want: &CSVSink{}},
+		"jsonl":  {conn: "jsonl://" + dir, want: &JSONLSink{}},
+		"mem":    {conn: "mem://test", want: &MemSink{}},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			sink, err := OpenSink(tc.conn)
+			require.NoError(t, err)
+			require.IsType(t, tc.want, sink)
+			require.NoError(t, sink.Close())
+		})
+	}
+	_, err := OpenSink("mysql://localhost")
+	require.Error(t, err)
+	require.Equal(t, GetMemSink("test"), GetMemSink("test"))
+}
+
+func TestCSVSink(t *testing.T) {
+	dir := tempDir(t)
+	sink, err := NewCSVSink(dir)
+	require.NoError(t, err)
+	persistTwice(t, sink)
+
+	f, err := os.Open(filepath.Join(dir, "entries.csv"))
+	require.NoError(t, err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, 5, len(records))
+	require.Equal(t, []string{"date", "country", "cases", "rate"}, records[0])
+	require.Equal(t, []string{"Spain", "100", "0.25"}, records[4][1:])
+
+	bad := sinkTableFixture()
+	bad.Columns[2].Name = "deaths"
+	require.Error(t, sink.SetupSchema(context.Background(), bad))
+}
+
+func TestJSONLSink(t *testing.T) {
+	dir := tempDir(t)
+	sink, err := NewJSONLSink(dir)
+	require.NoError(t, err)
+	persistTwice(t, sink)
+
+	f, err := os.Open(filepath.Join(dir, "entries.jsonl"))
+	require.NoError(t, err)
+	defer f.Close()
+	var rows []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		row := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+		rows = append(rows, row)
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, 4, len(rows))
+	require.Equal(t, "Italy", rows[2]["country"])
+	require.Equal(t, 200.0, rows[2]["cases"])
+	require.Contains(t, rows[2], "date")
+}
+
+func TestSQLiteSink(t *testing.T) {
+	sink, err := OpenSQLiteSink(filepath.Join(tempDir(t), "covid.db"))
+	require.NoError(t, err)
+	defer sink.Close()
+	persistTwice(t, sink)
+
+	var cnt, cases int
+	require.NoError(t, sink.db.QueryRow("SELECT count(*) FROM entries").Scan(&cnt))
+	require.Equal(t, 4, cnt)
+	require.NoError(t, sink.db.QueryRow("SELECT cases FROM entries WHERE country = 'Spain' LIMIT 1").Scan(&cases))
+	require.Equal(t, 100, cases)
+
+	bad := sinkTableFixture()
+	bad.Columns[1].Type = StringType
+	require.Error(t, sink.SetupSchema(context.Background(), bad))
+}
+
+func TestPersistContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, conn := range []string{"sqlite://" + filepath.Join(tempDir(t), "covid.db"), "csv://" + tempDir(t), "mem://cancelled"} {
+		err := PersistContext(ctx, conn, sinkTableFixture())
+		require.True(t, errors.Is(err, context.Canceled), conn)
+	}
+	require.Nil(t, GetMemSink("cancelled").Table("entries"))
+}
+
+func TestMemSink(t *testing.T) {
+	sink := NewMemSink()
+	persistTwice(t, sink)
+	got := sink.Table("entries")
+	require.Equal(t, 4, len(got.Cells))
+	require.Equal(t, sinkTableFixture().Columns, got.Columns)
+	require.Nil(t, sink.Table("unknown"))
+
+	bad := sinkTableFixture()
+	bad.Columns = bad.Columns[:2]
+	require.Error(t, sink.SetupSchema(context.Background(), bad))
+}
+
+func persistTwice(t *testing.T, sink Sink) {
+	t.Helper()
+	require.NoError(t, PersistTo(sink, sinkTableFixture()))
+	require.NoError(t, PersistTo(sink, sinkTableFixture()))
+}
@@ -0,0 +1,92 @@
+package table
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juliaogris/covid19/pkg/htmlx"
+	"golang.org/x/net/html"
+)
+
+// CellSource selects which part of a cell a column is parsed from.
+type CellSource string
+
+const (
+	TextSource      CellSource = ""           // text of the cell or Selector match, also "text"
+	AttrSource      CellSource = "attr"       // attribute ColumnDef.Attr, e.g. data-sort-value
+	LinkHrefSource  CellSource = "link_href"  // href of the first link
+	LinkTitleSource CellSource = "link_title" // title of the first link
+)
+
+func (s CellSource) String() string {
+	if s == TextSource {
+		return "text"
+	}
+	return string(s)
+}
+
+func (s CellSource) isText() bool {
+	return s == TextSource || s == "text"
+}
+
+func validateSource(colDef ColumnDef) error {
+	switch {
+	case colDef.Source.isText(), colDef.Source == LinkHrefSource, colDef.Source == LinkTitleSource:
+		if colDef.Attr != "" {
+			return fmt.Errorf("attr for source %s", colDef.Source)
+		}
+	case colDef.Source == AttrSource:
+		if colDef.Attr == "" {
+			return fmt.Errorf("no attr for source %s", colDef.Source)
+		}
+	default:
+		return fmt.Errorf("unknown source '%s'", colDef.Source)
+	}
+	return nil // Selector is checked by compileColumnDefs
+}
+
+var linkSelector = htmlx.MustCompile("a")
+
+// cellText returns the text to parse for c. Cells without the selected
+// element, attribute or link give an empty string.
+func (colDef ColumnDef) cellText(c cell) string {
+	if c.node == nil || (colDef.Selector == "" && colDef.Source.isText()) {
+		return c.text
+	}
+	n := c.node
+	if colDef.Selector != "" {
+		sel := colDef.selector
+		if sel == nil {
+			var err error
+			if sel, err = htmlx.Compile(colDef.Selector); err != nil {
+				return ""
+			}
+		}
+		if n = sel.Query(c.node); n == nil {
+			return ""
+		}
+	}
+	switch colDef.Source {
+	case AttrSource:
+		return getAttr(n, colDef.Attr)
+	case LinkHrefSource, LinkTitleSource:
+		a := linkSelector.Query(n)
+		if a == nil {
+			return ""
+		}
+		if colDef.Source == LinkHrefSource {
+			return getAttr(a, "href")
+		}
+		return getAttr(a, "title")
+	}
+	return strings.TrimSpace(getText(n))
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
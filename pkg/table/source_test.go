@@ -0,0 +1,71 @@
+package table
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const sourceDoc = `<table>
+<tr><th>Flag</th><th>Country</th><th>Cases</th><th>Region</th></tr>
+<tr>
+  <td><span class="flagicon"><img alt="Italy" src="it.svg"></span></td>
+  <th><a href="/wiki/COVID-19_in_Italy" title="COVID-19 pandemic in Italy">Italy</a><sup><a href="#cite_note-1">[a]</a></sup></th>
+  <td data-sort-value="1234567">1.2 million</td>
+  <td rowspan="2"><span class="region">Europe</span> (south)</td>
+</tr>
+<tr>
+  <td></td>
+  <th>Spain</th>
+  <td>2,000</td>
+</tr>
+</table>`
+
+func TestCellSourceScrape(t *testing.T) {
+	tests := map[string]struct {
+		column int
+		colDef ColumnDef
+		want   []interface{}
+	}{
+		"img_alt":    {column: 0, colDef: ColumnDef{Type: StringType, Selector: "img", Source: AttrSource, Attr: "alt"}, want: []interface{}{"Italy", ""}},
+		"text":       {column: 1, colDef: ColumnDef{Type: StringType, Source: "text", TruncateFrom: "["}, want: []interface{}{"Italy", "Spain"}},
+		"link_href":  {column: 1, colDef: ColumnDef{Type: StringType, Source: LinkHrefSource}, want: []interface{}{"/wiki/COVID-19_in_Italy", ""}},
+		"link_title": {column: 1, colDef: ColumnDef{Type: StringType, Source: LinkTitleSource}, want: []interface{}{"COVID-19 pandemic in Italy", ""}},
+		"sort_value": {column: 2, colDef: ColumnDef{Type: IntType, Source: AttrSource, Attr: "data-sort-value", Nullable: true}, want: []interface{}{1234567, nil}},
+		"selector":   {column: 3, colDef: ColumnDef{Type: StringType, Selector: "span.region"}, want: []interface{}{"Europe", "Europe"}},
+		"sub_link":   {column: 1, colDef: ColumnDef{Type: StringType, Selector: "sup", Source: LinkHrefSource}, want: []interface{}{"#cite_note-1", ""}},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			colDefs := []ColumnDef{{Skip: true}, {Skip: true}, {Skip: true}, {Skip: true}}
+			tc.colDef.TargetName = "a"
+			colDefs[tc.column] = tc.colDef
+			s := &Scraper{CSSSelector: "table", ColumnDefs: colDefs, HeaderRowCount: 1}
+			require.NoError(t, ValidateScraper(s))
+			table, _, err := s.scrapeFromReader(strings.NewReader(sourceDoc))
+			require.NoError(t, err)
+			require.Equal(t, [][]interface{}{{tc.want[0]}, {tc.want[1]}}, table.Cells)
+		})
+	}
+}
+
+func TestCellSourceErr(t *testing.T) {
+	tests := map[string]ColumnDef{
+		"unknown":        {Source: "html"},
+		"attr_no_name":   {Source: AttrSource},
+		"text_with_attr": {Attr: "data-sort-value"},
+		"link_with_attr": {Source: LinkHrefSource, Attr: "href"},
+		"bad_selector":   {Selector: "span$"},
+	}
+	for name, colDef := range tests {
+		colDef := colDef
+		t.Run(name, func(t *testing.T) {
+			colDef.TargetName = "a"
+			colDef.Type = StringType
+			s := &Scraper{CSSSelector: "table", ColumnDefs: []ColumnDef{colDef}}
+			require.Error(t, ValidateScraper(s))
+		})
+	}
+}
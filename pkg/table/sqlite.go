@@ -0,0 +1,240 @@
+package table
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SQLiteSink writes to a SQLite database file. It needs the sqlite3
+// database/sql driver, registered by importing package
+// github.com/juliaogris/covid19/pkg/table/sqlite, so that programs
+// without SQLite do not depend on cgo.
+type SQLiteSink struct {
+	db *sql.DB
+}
+
+func OpenSQLiteSink(filename string) (*SQLiteSink, error) {
+	return openSQLiteSink(context.Background(), filename)
+}
+
+func openSQLiteSink(ctx context.Context, filename string) (*SQLiteSink, error) {
+	if filename == "" {
+		return nil, fmt.Errorf("no sqlite database file")
+	}
+	if !hasDriver("sqlite3") {
+		return nil, fmt.Errorf("no sqlite3 driver, import github.com/juliaogris/covid19/pkg/table/sqlite")
+	}
+	db, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &SQLiteSink{db: db}, nil
+}
+
+func (s *SQLiteSink) SetupSchema(ctx context.Context, t *Table) error {
+	if !identifierRe.MatchString(t.Name) {
+		return fmt.Errorf("invalid table name, must be SQL identifier")
+	}
+	cols := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		if !identifierRe.MatchString(col.Name) {
+			return fmt.Errorf("invalid column name, must be SQL identifier")
+		}
+		sqliteType, err := getSQLiteType(col.Type)
+		if err != nil {
+			return err
+		}
+		cols[i] = col.Name + " " + sqliteType
+	}
+	if _, err := s.db.ExecContext(ctx, createSQLiteRunsTableStmt); err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, createRejectsTableStmt); err != nil {
+		return err
+	}
+	stmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id integer PRIMARY KEY AUTOINCREMENT,
+		date timestamp NOT NULL,
+		run_id integer REFERENCES %s (id),
+		%s
+	)`, t.Name, runsTable, strings.Join(cols, ",\n\t\t"))
+	if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	if err := s.addRunID(ctx, t); err != nil {
+		return err
+	}
+	if err := createKeyIndex(ctx, s.db, t, sqliteIndexDefQuery); err != nil {
+		return err
+	}
+	return s.validateSchema(ctx, t)
+}
+
+// addRunID adds the run_id column to tables created before scrape runs
+// were recorded. SQLite has no ADD COLUMN IF NOT EXISTS.
+func (s *SQLiteSink) addRunID(ctx context.Context, t *Table) error {
+	q := fmt.Sprintf("SELECT count(*) FROM pragma_table_info('%s') WHERE name = 'run_id'", t.Name)
+	var cnt int
+	if err := s.db.QueryRowContext(ctx, q).Scan(&cnt); err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return nil
+	}
+	stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN run_id integer REFERENCES %s (id)", t.Name, runsTable)
+	_, err := s.db.ExecContext(ctx, stmt)
+	return err
+}
+
+// getSQLiteType returns the declared SQLite type. Decimals are stored as
+// text as numeric affinity would turn them into floating point numbers.
+func getSQLiteType(t ColType) (string, error) {
+	switch t {
+	case StringType, DecimalType:
+		return "text", nil
+	case IntType, Int64Type:
+		return "integer", nil
+	case Float64Type, PercentType:
+		return "real", nil
+	case BoolType:
+		return "boolean", nil
+	case DateType:
+		return "date", nil
+	case TimeType:
+		return "timestamp", nil
+	}
+	return "", fmt.Errorf("unknown column type '%s'", t)
+}
+
+func (s *SQLiteSink) validateSchema(ctx context.Context, t *Table) error {
+	types := map[string]string{"id": "integer", "date": "timestamp", "run_id": "integer"}
+	for _, col := range t.Columns {
+		types[col.Name], _ = getSQLiteType(col.Type)
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", t.Name))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cnt := 0
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, dataType string
+		var dflt *string
+		if err := rows.Scan(&cid, &name, &dataType, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if types[name] != strings.ToLower(dataType) {
+			return fmt.Errorf("expected sqlite type '%s' got '%s' for column '%s'", types[name], dataType, name)
+		}
+		cnt++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if cnt != len(types) {
+		return fmt.Errorf("expected %d columns, got %d", len(types), cnt)
+	}
+	return nil
+}
+
+func (s *SQLiteSink) Write(ctx context.Context, t *Table) error {
+	if err := checkUniqueKey(t); err != nil {
+		return err
+	}
+	txn, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.insertRows(ctx, txn, t); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	return txn.Commit()
+}
+
+func (s *SQLiteSink) insertRows(ctx context.Context, txn *sql.Tx, t *Table) error {
+	if t.SkipUnchanged {
+		unchanged, err := isUnchangedSnapshot(ctx, txn, t)
+		if err != nil {
+			return err
+		}
+		if unchanged {
+			return ErrUnchanged
+		}
+	}
+	run := getRun(t)
+	runID, err := insertSQLiteRun(ctx, txn, run)
+	if err != nil {
+		return err
+	}
+	run.ID = runID
+	if err := insertRejects(ctx, txn, insertSQLiteRejectStmt, run); err != nil {
+		return err
+	}
+	date := t.date()
+	colNames := getInsertColNames(t)
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(colNames)), ", ")
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", t.Name, strings.Join(colNames, ", "), placeholders)
+	if len(t.Key) != 0 {
+		q += getOnConflict(t)
+	}
+	stmt, err := txn.PrepareContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, row := range t.Cells {
+		vals := append([]interface{}{date, runID}, row...)
+		if _, err := stmt.ExecContext(ctx, vals...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var createSQLiteRunsTableStmt = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id integer PRIMARY KEY AUTOINCREMENT,
+		table_name text NOT NULL,
+		url text NOT NULL,
+		revision text NOT NULL,
+		scraper_version text NOT NULL,
+		started timestamp NOT NULL,
+		duration_ms integer NOT NULL,
+		row_count integer NOT NULL,
+		rejected_count integer NOT NULL
+	)`, runsTable)
+
+func insertSQLiteRun(ctx context.Context, txn *sql.Tx, run *Run) (int64, error) {
+	q := fmt.Sprintf(`INSERT INTO %s
+		(table_name, url, revision, scraper_version, started, duration_ms, row_count, rejected_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, runsTable)
+	res, err := txn.ExecContext(ctx, q, run.TableName, run.URL, run.Revision, run.ScraperVersion,
+		run.Started, run.Duration.Milliseconds(), run.RowCount, run.RejectedCount)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+var insertSQLiteRejectStmt = fmt.Sprintf("INSERT INTO %s (run_id, row_index, cells, error) VALUES (?, ?, ?, ?)", rejectsTable)
+
+func (s *SQLiteSink) Close() error {
+	return s.db.Close()
+}
+
+func hasDriver(name string) bool {
+	for _, d := range sql.Drivers() {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,8 @@
+// Package sqlite registers the cgo based sqlite3 database/sql driver
+// used by the sqlite:// sink of package table. Import it for its side
+// effect in programs that write to SQLite:
+//
+//	import _ "github.com/juliaogris/covid19/pkg/table/sqlite"
+package sqlite
+
+import _ "github.com/mattn/go-sqlite3" // register sqlite3 database/sql driver
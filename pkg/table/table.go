@@ -6,17 +6,23 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Table struct {
 	Name    string
 	Columns []Column
 	Cells   [][]interface{} // string, int64, float32 TODO: better: Rows []Row
+
+	Key           []string  // natural key column names, may include "date"; existing rows are updated
+	SkipUnchanged bool      // don't write rows equal to the last written snapshot
+	Run           *Run      // provenance, written by SQL sinks
+	AsOf          time.Time // time the data was published, if known
 }
 
 type Column struct {
 	Name string
-	Type reflect.Kind
+	Type ColType
 }
 
 func (t *Table) GetColumnNames() []string {
@@ -27,6 +33,14 @@ func (t *Table) GetColumnNames() []string {
 	return colNames
 }
 
+// date returns the value of the date column written with every row.
+func (t *Table) date() time.Time {
+	if !t.AsOf.IsZero() {
+		return t.AsOf
+	}
+	return time.Now().UTC()
+}
+
 func (t *Table) String() string {
 	format := t.getFormat()
 
@@ -1,7 +1,6 @@
 package table
 
 import (
-	"reflect"
 	"strings"
 	"testing"
 
@@ -11,10 +10,10 @@ import (
 func tableFixture() *Table {
 	return &Table{
 		Columns: []Column{
-			{"c1", reflect.String},
-			{"c2", reflect.String},
-			{"c3", reflect.String},
-			{"c4", reflect.String},
+			{"c1", StringType},
+			{"c2", StringType},
+			{"c3", StringType},
+			{"c4", StringType},
 		},
 		Cells: [][]interface{}{
 			{"a1", "a2", "a3", "a4"},
@@ -0,0 +1,223 @@
+package table
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// TransformDef references a named cell transform with its arguments in a
+// column definition, e.g.
+//
+//	transforms:
+//	- {name: strip_footnotes}
+//	- {name: regex_replace, args: {pattern: '\s*\(.*\)$', replacement: ""}}
+//	- {name: lookup, args: {USA: United States}}
+type TransformDef struct {
+	Name string            `yaml:"name"`
+	Args map[string]string `yaml:"args"`
+}
+
+// TransformFunc transforms cell text before it is parsed.
+type TransformFunc func(string) (string, error)
+
+// TransformFactory returns a TransformFunc for the arguments of a
+// TransformDef. It should validate the arguments as it is called when
+// scrapers are validated.
+type TransformFactory func(args map[string]string) (TransformFunc, error)
+
+var (
+	transformsMu sync.RWMutex
+	transforms   = map[string]TransformFactory{
+		"regex_extract":   newRegexExtract,
+		"regex_replace":   newRegexReplace,
+		"strip_footnotes": newStripFootnotes,
+		"normalize":       newNormalize,
+		"lower":           newCaseTransform(strings.ToLower),
+		"upper":           newCaseTransform(strings.ToUpper),
+		"fold":            newCaseTransform(cases.Fold().String),
+		"lookup":          newLookup,
+	}
+)
+
+// RegisterTransform makes a transform available by name in column
+// definitions. It panics if factory is nil or name is already registered.
+func RegisterTransform(name string, factory TransformFactory) {
+	transformsMu.Lock()
+	defer transformsMu.Unlock()
+	if factory == nil {
+		panic("table: RegisterTransform factory is nil")
+	}
+	if _, ok := transforms[name]; ok {
+		panic("table: RegisterTransform called twice for " + name)
+	}
+	transforms[name] = factory
+}
+
+// Transforms returns the sorted names of registered transforms.
+func Transforms() []string {
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+	names := make([]string, 0, len(transforms))
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compileTransforms returns the TransformFuncs for defs in order.
+func compileTransforms(defs []TransformDef) ([]TransformFunc, error) {
+	if len(defs) == 0 {
+		return nil, nil
+	}
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+	result := make([]TransformFunc, len(defs))
+	for i, def := range defs {
+		factory, ok := transforms[def.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown transform '%s'", def.Name)
+		}
+		fn, err := factory(def.Args)
+		if err != nil {
+			return nil, fmt.Errorf("transform %d (%s): %w", i, def.Name, err)
+		}
+		result[i] = fn
+	}
+	return result, nil
+}
+
+func (c ColumnDef) transform(s string) (string, error) {
+	fns := c.transforms
+	if fns == nil && len(c.Transforms) != 0 {
+		var err error
+		if fns, err = compileTransforms(c.Transforms); err != nil {
+			return "", err
+		}
+	}
+	for _, fn := range fns {
+		var err error
+		if s, err = fn(s); err != nil {
+			return "", err
+		}
+	}
+	return s, nil
+}
+
+func checkArgs(args map[string]string, required []string, optional ...string) error {
+	for _, k := range required {
+		if _, ok := args[k]; !ok {
+			return fmt.Errorf("missing argument '%s'", k)
+		}
+	}
+	for k := range args {
+		if !contains(required, k) && !contains(optional, k) {
+			return fmt.Errorf("unknown argument '%s'", k)
+		}
+	}
+	return nil
+}
+
+// newRegexExtract returns the first match of args["pattern"], or of its
+// capture group args["group"], which defaults to 1 if the pattern has
+// groups. Text without match becomes empty.
+func newRegexExtract(args map[string]string) (TransformFunc, error) {
+	if err := checkArgs(args, []string{"pattern"}, "group"); err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(args["pattern"])
+	if err != nil {
+		return nil, err
+	}
+	group := 0
+	if re.NumSubexp() > 0 {
+		group = 1
+	}
+	if g, ok := args["group"]; ok {
+		if group, err = strconv.Atoi(g); err != nil || group < 0 || group > re.NumSubexp() {
+			return nil, fmt.Errorf("invalid group '%s'", g)
+		}
+	}
+	return func(s string) (string, error) {
+		m := re.FindStringSubmatch(s)
+		if m == nil {
+			return "", nil
+		}
+		return m[group], nil
+	}, nil
+}
+
+// newRegexReplace replaces all matches of args["pattern"] with
+// args["replacement"], which may reference groups as $1 or ${name}.
+func newRegexReplace(args map[string]string) (TransformFunc, error) {
+	if err := checkArgs(args, []string{"pattern"}, "replacement"); err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(args["pattern"])
+	if err != nil {
+		return nil, err
+	}
+	replacement := args["replacement"]
+	return func(s string) (string, error) {
+		return re.ReplaceAllString(s, replacement), nil
+	}, nil
+}
+
+// newStripFootnotes removes footnote markers such as "[a]" or "[12]"
+// anywhere in the text, unlike TruncateFrom.
+func newStripFootnotes(args map[string]string) (TransformFunc, error) {
+	if err := checkArgs(args, nil); err != nil {
+		return nil, err
+	}
+	return func(s string) (string, error) {
+		return footnoteRe.ReplaceAllString(s, ""), nil
+	}, nil
+}
+
+// newNormalize applies unicode normalization args["form"], one of NFC
+// (default), NFD, NFKC and NFKD.
+func newNormalize(args map[string]string) (TransformFunc, error) {
+	if err := checkArgs(args, nil, "form"); err != nil {
+		return nil, err
+	}
+	forms := map[string]norm.Form{"": norm.NFC, "NFC": norm.NFC, "NFD": norm.NFD, "NFKC": norm.NFKC, "NFKD": norm.NFKD}
+	form, ok := forms[strings.ToUpper(args["form"])]
+	if !ok {
+		return nil, fmt.Errorf("unknown normalization form '%s'", args["form"])
+	}
+	return func(s string) (string, error) {
+		return form.String(s), nil
+	}, nil
+}
+
+func newCaseTransform(fn func(string) string) TransformFactory {
+	return func(args map[string]string) (TransformFunc, error) {
+		if err := checkArgs(args, nil); err != nil {
+			return nil, err
+		}
+		return func(s string) (string, error) {
+			return fn(s), nil
+		}, nil
+	}
+}
+
+// newLookup maps text found as key in args to its value. Other text is
+// left unchanged.
+func newLookup(args map[string]string) (TransformFunc, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty lookup table")
+	}
+	return func(s string) (string, error) {
+		if v, ok := args[s]; ok {
+			return v, nil
+		}
+		return s, nil
+	}, nil
+}
@@ -0,0 +1,125 @@
+package table
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransforms(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		defs  []TransformDef
+		want  string
+	}{
+		"extract":         {input: "Italy (mainland)", defs: []TransformDef{{Name: "regex_extract", Args: map[string]string{"pattern": `^(\w+)`}}}, want: "Italy"},
+		"extract_group":   {input: "12 of 30", defs: []TransformDef{{Name: "regex_extract", Args: map[string]string{"pattern": `(\d+) of (\d+)`, "group": "2"}}}, want: "30"},
+		"extract_nomatch": {input: "n/a", defs: []TransformDef{{Name: "regex_extract", Args: map[string]string{"pattern": `\d+`}}}, want: ""},
+		"replace":         {input: "Korea, South", defs: []TransformDef{{Name: "regex_replace", Args: map[string]string{"pattern": `^(.*), (.*)$`, "replacement": "$2 $1"}}}, want: "South Korea"},
+		"replace_delete":  {input: "Spain (total)", defs: []TransformDef{{Name: "regex_replace", Args: map[string]string{"pattern": `\s*\(.*\)`}}}, want: "Spain"},
+		"footnotes":       {input: "Diamond Princess[a][12] cruise[note 1]", defs: []TransformDef{{Name: "strip_footnotes"}}, want: "Diamond Princess cruise"},
+		"nfc":             {input: "Côte d'Ivoire", defs: []TransformDef{{Name: "normalize"}}, want: "Côte d'Ivoire"},
+		"nfkc":            {input: "１２３", defs: []TransformDef{{Name: "normalize", Args: map[string]string{"form": "NFKC"}}}, want: "123"},
+		"lower":           {input: "ITALY", defs: []TransformDef{{Name: "lower"}}, want: "italy"},
+		"upper":           {input: "gb", defs: []TransformDef{{Name: "upper"}}, want: "GB"},
+		"fold":            {input: "Straße", defs: []TransformDef{{Name: "fold"}}, want: "strasse"},
+		"lookup":          {input: "USA", defs: []TransformDef{{Name: "lookup", Args: map[string]string{"USA": "United States"}}}, want: "United States"},
+		"lookup_miss":     {input: "Italy", defs: []TransformDef{{Name: "lookup", Args: map[string]string{"USA": "United States"}}}, want: "Italy"},
+		"pipeline": {
+			input: "  S. Korea[b] ",
+			defs: []TransformDef{
+				{Name: "strip_footnotes"},
+				{Name: "lower"},
+				{Name: "lookup", Args: map[string]string{"s. korea": "South Korea"}},
+			},
+			want: "South Korea",
+		},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			got, err := parseCell(tc.input, ColumnDef{Type: StringType, Transforms: tc.defs})
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestTransformsErr(t *testing.T) {
+	tests := map[string]TransformDef{
+		"unknown":         {Name: "reverse"},
+		"no_pattern":      {Name: "regex_extract"},
+		"bad_pattern":     {Name: "regex_replace", Args: map[string]string{"pattern": "("}},
+		"bad_group":       {Name: "regex_extract", Args: map[string]string{"pattern": "(a)", "group": "2"}},
+		"unknown_arg":     {Name: "regex_replace", Args: map[string]string{"pattern": "a", "replace": "b"}},
+		"footnote_arg":    {Name: "strip_footnotes", Args: map[string]string{"marker": "["}},
+		"bad_form":        {Name: "normalize", Args: map[string]string{"form": "NFX"}},
+		"empty_lookup":    {Name: "lookup"},
+		"lower_with_args": {Name: "lower", Args: map[string]string{"locale": "tr"}},
+	}
+	for name, def := range tests {
+		def := def
+		t.Run(name, func(t *testing.T) {
+			colDefs := []ColumnDef{{TargetName: "a", Type: StringType, Transforms: []TransformDef{def}}}
+			_, err := compileColumnDefs(colDefs)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestRegisterTransform(t *testing.T) {
+	RegisterTransform("test_repeat", func(args map[string]string) (TransformFunc, error) {
+		sep, ok := args["sep"]
+		if !ok {
+			return nil, fmt.Errorf("missing argument 'sep'")
+		}
+		return func(s string) (string, error) {
+			if s == "" {
+				return "", fmt.Errorf("empty cell")
+			}
+			return s + sep + s, nil
+		}, nil
+	})
+	require.Contains(t, Transforms(), "test_repeat")
+	require.Panics(t, func() { RegisterTransform("test_repeat", newLookup) })
+	require.Panics(t, func() { RegisterTransform("test_nil", nil) })
+
+	colDef := ColumnDef{TargetName: "a", Type: IntType, Transforms: []TransformDef{{Name: "test_repeat", Args: map[string]string{"sep": ""}}}}
+	require.NoError(t, validateColumnDefs([]ColumnDef{colDef}, false))
+	got, err := parseCell("12", colDef)
+	require.NoError(t, err)
+	require.Equal(t, 1212, got)
+	_, err = parseCell(" ", colDef)
+	require.Error(t, err)
+
+	colDefs, err := compileColumnDefs([]ColumnDef{colDef})
+	require.NoError(t, err)
+	require.Len(t, colDefs[0].transforms, 1)
+	require.Nil(t, colDef.transforms)
+}
+
+func TestParseScrapersTransforms(t *testing.T) {
+	input := `
+scrapers:
+- url: x
+  css_selector: table
+  column_defs:
+  - target_name: country
+    type: string
+    transforms:
+    - {name: strip_footnotes}
+    - {name: lookup, args: {USA: United States}}
+`
+	scrapers, err := ParseScrapers([]byte(input))
+	require.NoError(t, err)
+	want := []TransformDef{
+		{Name: "strip_footnotes"},
+		{Name: "lookup", Args: map[string]string{"USA": "United States"}},
+	}
+	require.Equal(t, want, scrapers[0].Scraper().ColumnDefs[0].Transforms)
+
+	_, err = ParseScrapers([]byte(strings.Replace(input, "strip_footnotes", "strip_notes", 1)))
+	require.Error(t, err)
+}
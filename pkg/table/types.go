@@ -0,0 +1,181 @@
+package table
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColType is the type of a column as given in config files, e.g. "int".
+type ColType string
+
+const (
+	StringType  ColType = "string"
+	IntType     ColType = "int"
+	Int64Type   ColType = "int64"
+	Float64Type ColType = "float64"
+	BoolType    ColType = "bool"    // true/false, yes/no, y/n, 1/0, ✓/✗
+	DateType    ColType = "date"    // time.Time at midnight UTC, parsed with ColumnDef.Layout
+	TimeType    ColType = "time"    // time.Time in UTC, parsed with ColumnDef.Layout
+	PercentType ColType = "percent" // float64 in percent, "12.3%" is 12.3
+	DecimalType ColType = "decimal" // json.Number keeping all digits, e.g. "1234.50"
+)
+
+const (
+	defaultDateLayout = "2006-01-02"
+	defaultTimeLayout = time.RFC3339
+)
+
+var (
+	trueValues  = []string{"true", "yes", "y", "1", "✓", "✔"}
+	falseValues = []string{"false", "no", "n", "0", "✗", "✘"}
+
+	decimalRe = regexp.MustCompile(`^-?([0-9]+(\.[0-9]*)?|\.[0-9]+)$`)
+)
+
+// canonicalDecimal returns the decimal s, as matched by decimalRe, as
+// valid JSON number without leading zeros and with digits on both sides
+// of the decimal point, e.g. "0.5" for ".5" and "1" for "1.". Trailing
+// zeros are kept.
+func canonicalDecimal(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, frac := s, ""
+	if i := strings.Index(s, "."); i != -1 {
+		intPart, frac = s[:i], s[i+1:]
+	}
+	if intPart = strings.TrimLeft(intPart, "0"); intPart == "" {
+		intPart = "0"
+	}
+	if frac == "" {
+		return sign + intPart
+	}
+	return sign + intPart + "." + frac
+}
+
+func zero(t ColType) (interface{}, error) {
+	switch t {
+	case StringType:
+		return "", nil
+	case IntType, Int64Type:
+		return 0, nil
+	case Float64Type, PercentType:
+		return 0.0, nil
+	case BoolType:
+		return false, nil
+	case DateType, TimeType:
+		return time.Time{}, nil
+	case DecimalType:
+		return json.Number("0"), nil
+	}
+	return nil, fmt.Errorf("unknown column type '%s'", t)
+}
+
+func isNumeric(t ColType) bool {
+	switch t {
+	case IntType, Int64Type, Float64Type, PercentType, DecimalType:
+		return true
+	}
+	return false
+}
+
+// parseValue parses the trimmed cell text c as value of colDef.Type.
+func parseValue(c string, colDef ColumnDef) (interface{}, error) {
+	switch colDef.Type {
+	case StringType:
+		return c, nil
+	case IntType, Int64Type:
+		n, err := colDef.NumberFormat.normalize(c)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.Atoi(n)
+	case Float64Type:
+		n, err := colDef.NumberFormat.normalize(c)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.ParseFloat(n, 64)
+	case PercentType:
+		n, err := colDef.NumberFormat.normalize(strings.TrimSuffix(strings.TrimSpace(c), "%"))
+		if err != nil {
+			return nil, err
+		}
+		return strconv.ParseFloat(n, 64)
+	case DecimalType:
+		n, err := colDef.NumberFormat.normalize(c)
+		if err != nil {
+			return nil, err
+		}
+		n = strings.TrimPrefix(n, "+")
+		if !decimalRe.MatchString(n) {
+			return nil, fmt.Errorf("invalid decimal '%s'", c)
+		}
+		return json.Number(canonicalDecimal(n)), nil
+	case BoolType:
+		return parseBool(c)
+	case DateType:
+		t, err := time.Parse(colDef.layout(), c)
+		if err != nil {
+			return nil, err
+		}
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+	case TimeType:
+		t, err := time.Parse(colDef.layout(), c)
+		if err != nil {
+			return nil, err
+		}
+		return t.UTC(), nil
+	}
+	return nil, fmt.Errorf("unknown column type '%s'", colDef.Type)
+}
+
+func parseBool(c string) (bool, error) {
+	lc := strings.ToLower(c)
+	if contains(trueValues, lc) {
+		return true, nil
+	}
+	if contains(falseValues, lc) {
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid bool '%s'", c)
+}
+
+func (c ColumnDef) layout() string {
+	switch {
+	case c.Layout != "":
+		return c.Layout
+	case c.Type == DateType:
+		return defaultDateLayout
+	}
+	return defaultTimeLayout
+}
+
+// zero returns the value used for ZeroValues, blank spanned and missing
+// cells: nil for nullable columns or the zero value of the column type.
+func (c ColumnDef) zero() (interface{}, error) {
+	if c.Nullable {
+		return nil, nil
+	}
+	return zero(c.Type)
+}
+
+// formatValue formats v for text output such as CSV, with dates as
+// "2006-01-02", times as RFC 3339 and NULL as empty string.
+func formatValue(t ColType, v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if t == DateType {
+			return v.Format(defaultDateLayout)
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
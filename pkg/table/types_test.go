@@ -0,0 +1,148 @@
+package table
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCellTypes(t *testing.T) {
+	date := time.Date(2020, 3, 31, 0, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		input  string
+		colDef ColumnDef
+		want   interface{}
+	}{
+		"int":              {input: " 1,234 ", colDef: ColumnDef{Type: IntType}, want: 1234},
+		"float":            {input: "1,234.5", colDef: ColumnDef{Type: Float64Type}, want: 1234.5},
+		"percent":          {input: "12.3%", colDef: ColumnDef{Type: PercentType}, want: 12.3},
+		"percent_space":    {input: "5 %", colDef: ColumnDef{Type: PercentType}, want: 5.0},
+		"decimal":          {input: "1,234.50", colDef: ColumnDef{Type: DecimalType}, want: json.Number("1234.50")},
+		"decimal_neg":      {input: "-.5", colDef: ColumnDef{Type: DecimalType}, want: json.Number("-0.5")},
+		"decimal_point":    {input: "1.", colDef: ColumnDef{Type: DecimalType}, want: json.Number("1")},
+		"decimal_zeros":    {input: "007.50", colDef: ColumnDef{Type: DecimalType}, want: json.Number("7.50")},
+		"bool_yes":         {input: "Yes", colDef: ColumnDef{Type: BoolType}, want: true},
+		"bool_check":       {input: "✓", colDef: ColumnDef{Type: BoolType}, want: true},
+		"bool_no":          {input: "n", colDef: ColumnDef{Type: BoolType}, want: false},
+		"date":             {input: "2020-03-31", colDef: ColumnDef{Type: DateType}, want: date},
+		"date_layout":      {input: "31 March 2020", colDef: ColumnDef{Type: DateType, Layout: "2 January 2006"}, want: date},
+		"time":             {input: "2020-03-31T02:00:00+02:00", colDef: ColumnDef{Type: TimeType}, want: date},
+		"zero_date":        {input: "–", colDef: ColumnDef{Type: DateType, ZeroValues: []string{"–"}}, want: time.Time{}},
+		"null":             {input: "–", colDef: ColumnDef{Type: IntType, ZeroValues: []string{"–"}, Nullable: true}, want: nil},
+		"null_empty":       {input: " ", colDef: ColumnDef{Type: DecimalType, Nullable: true}, want: nil},
+		"null_string":      {input: "", colDef: ColumnDef{Type: StringType, Nullable: true}, want: ""},
+		"null_string_zero": {input: "n/a", colDef: ColumnDef{Type: StringType, ZeroValues: []string{"n/a"}, Nullable: true}, want: nil},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			got, err := parseCell(tc.input, tc.colDef)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseCellTypesErr(t *testing.T) {
+	tests := map[string]ColumnDef{
+		"12%x":       {Type: PercentType},
+		"1.2.3":      {Type: DecimalType},
+		"1e3":        {Type: DecimalType},
+		"maybe":      {Type: BoolType},
+		"31/03/2020": {Type: DateType},
+		"2020-03-31": {Type: TimeType},
+		"":           {Type: IntType},
+		"x":          {Type: ColType("complex128")},
+	}
+	for input, colDef := range tests {
+		input, colDef := input, colDef
+		t.Run(input, func(t *testing.T) {
+			_, err := parseCell(input, colDef)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestParseRowNullable(t *testing.T) {
+	colDefs := []ColumnDef{
+		{TargetName: "a", Type: IntType, Nullable: true, BlankSpanned: true},
+		{TargetName: "b", Type: IntType, BlankSpanned: true},
+		{TargetName: "c", Type: DateType, Nullable: true},
+	}
+	row := []cell{{text: "1", spanned: true}, {text: "1", spanned: true}, {missing: true}}
+	got, err := parseRow(row, colDefs)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{nil, 0, nil}, got)
+}
+
+func TestRichTypesSQLiteSink(t *testing.T) {
+	sink, err := OpenSQLiteSink(filepath.Join(tempDir(t), "covid.db"))
+	require.NoError(t, err)
+	defer sink.Close()
+	date := time.Date(2020, 3, 31, 0, 0, 0, 0, time.UTC)
+	tt := &Table{
+		Name: "rich",
+		Columns: []Column{
+			{"day", DateType},
+			{"lockdown", BoolType},
+			{"positive", PercentType},
+			{"spend", DecimalType},
+			{"deaths", IntType},
+		},
+		Cells: [][]interface{}{
+			{date, true, 12.3, json.Number("1234.50"), nil},
+		},
+	}
+	require.NoError(t, PersistTo(sink, tt))
+
+	var day time.Time
+	var lockdown bool
+	var positive float64
+	var spend string
+	var deaths *int
+	row := sink.db.QueryRow("SELECT day, lockdown, positive, spend, deaths FROM rich")
+	require.NoError(t, row.Scan(&day, &lockdown, &positive, &spend, &deaths))
+	require.True(t, date.Equal(day))
+	require.True(t, lockdown)
+	require.Equal(t, 12.3, positive)
+	require.Equal(t, "1234.50", spend)
+	require.Nil(t, deaths)
+}
+
+func TestDecimalJSONLSink(t *testing.T) {
+	dir := tempDir(t)
+	sink, err := NewJSONLSink(dir)
+	require.NoError(t, err)
+	colDef := ColumnDef{Type: DecimalType}
+	tt := &Table{Name: "spend", Columns: []Column{{"spend", DecimalType}}}
+	for _, c := range []string{"1.", ".5", "-.5", "0500", "00.10"} {
+		v, err := parseCell(c, colDef)
+		require.NoError(t, err)
+		tt.Cells = append(tt.Cells, []interface{}{v})
+	}
+	require.NoError(t, PersistTo(sink, tt))
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "spend.jsonl"))
+	require.NoError(t, err)
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var row map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal([]byte(line), &row))
+		got = append(got, string(row["spend"]))
+	}
+	require.Equal(t, []string{"1", "0.5", "-0.5", "500", "0.10"}, got)
+}
+
+func TestFormatValue(t *testing.T) {
+	date := time.Date(2020, 3, 31, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, "2020-03-31", formatValue(DateType, date))
+	require.Equal(t, "2020-03-31T00:00:00Z", formatValue(TimeType, date))
+	require.Equal(t, "", formatValue(IntType, nil))
+	require.Equal(t, "1234.50", formatValue(DecimalType, json.Number("1234.50")))
+	require.Equal(t, "true", formatValue(BoolType, true))
+}